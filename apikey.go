@@ -0,0 +1,50 @@
+package restclient
+
+// APIKeyLocation defines where the api key is sent.
+type APIKeyLocation int
+
+const (
+	// APIKeyInHeader sends the api key as header, e.g. X-API-Key
+	APIKeyInHeader APIKeyLocation = iota
+	// APIKeyInQuery sends the api key as query param, e.g. api_key
+	APIKeyInQuery
+)
+
+const redacted = "***"
+
+// AddAPIKey sends the api key as header or query param,
+// the value is redacted in all log statements.
+func (r *RestClient) AddAPIKey(location APIKeyLocation, name string, value string) *RestClient {
+	if location == APIKeyInQuery {
+		r.AddQueryParam(name, value)
+	} else {
+		r.AddHeader(name, value)
+	}
+	r.AddSecret(value)
+	return r
+}
+
+// AddSecret redacts the value in all log statements.
+func (r *RestClient) AddSecret(value string) *RestClient {
+	if value != "" {
+		r.secrets = append(r.secrets, value)
+	}
+	return r
+}
+
+func (c *Client) AddAPIKey(location APIKeyLocation, name string, value string) *Client {
+	if location == APIKeyInQuery {
+		c.AddQueryParam(name, value)
+	} else {
+		c.AddHeader(name, value)
+	}
+	c.AddSecret(value)
+	return c
+}
+
+func (c *Client) AddSecret(value string) *Client {
+	if value != "" {
+		c.secrets = append(c.secrets, value)
+	}
+	return c
+}
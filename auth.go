@@ -0,0 +1,191 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const authorization = "Authorization"
+
+// Token is an access token, sent as bearer token.
+type Token struct {
+	AccessToken string
+	// Expiry is the time the token expires, zero if it never expires.
+	Expiry time.Time
+}
+
+// TokenSource provides the access token of a request.
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// TokenInvalidator is implemented by token sources that cache their token.
+// After a 401 response the token is invalidated, and the request is sent
+// once again with a new token.
+type TokenInvalidator interface {
+	Invalidate(token Token)
+}
+
+type staticToken string
+
+func (s staticToken) Token(ctx context.Context) (Token, error) {
+	return Token{AccessToken: string(s)}, nil
+}
+
+// StaticToken is a TokenSource with a fixed token.
+func StaticToken(token string) TokenSource {
+	return staticToken(token)
+}
+
+// AddBearerToken sends the token as bearer token in the Authorization header.
+func (r *RestClient) AddBearerToken(token string) *RestClient {
+	return r.AddTokenSource(StaticToken(token))
+}
+
+// AddTokenSource sends the token of the source as bearer token in the Authorization header.
+func (r *RestClient) AddTokenSource(source TokenSource) *RestClient {
+	r.tokenSource = source
+	return r
+}
+
+func (c *Client) AddBearerToken(token string) *Client {
+	return c.AddTokenSource(StaticToken(token))
+}
+
+func (c *Client) AddTokenSource(source TokenSource) *Client {
+	c.tokenSource = source
+	return c
+}
+
+// ClientCredentials is a TokenSource that fetches tokens via the OAuth2
+// client credentials grant (RFC 6749, section 4.4). The token is cached
+// until it expires.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// HttpClient is used to fetch the token, default is http.DefaultClient.
+	HttpClient *http.Client
+	// ExpiryDelta renews the token before it expires, default is 10 seconds.
+	ExpiryDelta time.Duration
+
+	mutex sync.Mutex
+	token Token
+}
+
+func NewClientCredentials(tokenURL string, clientID string, clientSecret string, scopes ...string) *ClientCredentials {
+	return &ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		ExpiryDelta:  10 * time.Second,
+	}
+}
+
+func (c *ClientCredentials) Token(ctx context.Context) (Token, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token.AccessToken != "" && (c.token.Expiry.IsZero() || time.Now().Add(c.ExpiryDelta).Before(c.token.Expiry)) {
+		return c.token, nil
+	}
+
+	token, err := c.fetch(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	c.token = token
+	return token, nil
+}
+
+func (c *ClientCredentials) Invalidate(token Token) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token.AccessToken == token.AccessToken {
+		c.token = Token{}
+	}
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	result := Post(c.TokenURL).
+		WithContext(ctx).
+		AddHttpClient(c.HttpClient).
+		AddBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret)).
+		AddFormDataBody(form).
+		SendAndGetJsonResponse(&response)
+	if err := result.Error(); err != nil {
+		return Token{}, err
+	}
+	if response.AccessToken == "" {
+		return Token{}, errors.New("restclient: no access token in token response")
+	}
+
+	token := Token{AccessToken: response.AccessToken}
+	if response.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// tokenMiddleware sets the bearer token and replays the request once
+// with a new token after a 401 response.
+func tokenMiddleware(source TokenSource) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			token, err := source.Token(request.Context())
+			if err != nil {
+				return nil, err
+			}
+			request.Header.Set(authorization, "Bearer "+token.AccessToken)
+
+			response, err := next(request)
+			if err != nil || response.StatusCode != http.StatusUnauthorized {
+				return response, err
+			}
+
+			invalidator, ok := source.(TokenInvalidator)
+			if !ok || (request.Body != nil && request.Body != http.NoBody && request.GetBody == nil) {
+				return response, nil
+			}
+			invalidator.Invalidate(token)
+
+			token, err = source.Token(request.Context())
+			if err != nil {
+				// keep the 401 response
+				return response, nil
+			}
+
+			replay := request.Clone(request.Context())
+			if request.GetBody != nil {
+				replay.Body, err = request.GetBody()
+				if err != nil {
+					return response, nil
+				}
+			}
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+
+			replay.Header.Set(authorization, "Bearer "+token.AccessToken)
+			return next(replay)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package restclient
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/maprost/restclient/rcdep"
+	"github.com/maprost/restclient/rcquery"
+)
+
+// Client holds the shared defaults (base url, header, query params, auth,
+// logger and http client) of a group of requests. Every request is created
+// via the Get/Post/Put/Patch/Delete/... methods of the client and can override the
+// defaults with its own settings.
+type Client struct {
+	baseURL       string
+	log           rcdep.Logger
+	httpClient    *http.Client
+	header        map[string][]string
+	query         []queryParam
+	queryOptions  []func(query *rcquery.Query)
+	basicAuthUser string
+	basicAuthPW   string
+	retryPolicy   *RetryPolicy
+	middlewares   []Middleware
+	tokenSource   TokenSource
+	secrets       []string
+	signer        Signer
+	logConfig     *LogConfig
+}
+
+type queryParam struct {
+	key   string
+	value interface{}
+}
+
+// New creates a Client, all request paths are relative to the baseURL.
+func New(baseURL string) *Client {
+	return &Client{
+		baseURL: baseURL,
+		header:  make(map[string][]string),
+	}
+}
+
+func (c *Client) AddLogger(logger rcdep.Logger) *Client {
+	c.log = logger
+	return c
+}
+
+func (c *Client) NoLogger() *Client {
+	c.log = noLogger{}
+	return c
+}
+
+func (c *Client) AddHttpClient(httpClient *http.Client) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// AddQueryParam adds a default query param, it is skipped if the request
+// adds a query param with the same key.
+func (c *Client) AddQueryParam(key string, value interface{}) *Client {
+	c.query = append(c.query, queryParam{key: key, value: value})
+	return c
+}
+
+// SetQueryKeyStyle sets the style of nested query keys of structs and maps
+// of all requests, default is rcquery.DotKeys.
+func (c *Client) SetQueryKeyStyle(style rcquery.KeyStyle) *Client {
+	c.queryOptions = append(c.queryOptions, func(query *rcquery.Query) {
+		query.SetKeyStyle(style)
+	})
+	return c
+}
+
+// SetQueryArrayFormat sets the default format of slices and arrays in query params
+// of all requests, default is rcquery.RepeatArray.
+func (c *Client) SetQueryArrayFormat(format rcquery.ArrayFormat) *Client {
+	c.queryOptions = append(c.queryOptions, func(query *rcquery.Query) {
+		query.SetArrayFormat(format)
+	})
+	return c
+}
+
+// SetQueryTimeLayout sets the layout of time.Time values in query params
+// of all requests, default is time.RFC3339.
+func (c *Client) SetQueryTimeLayout(layout string) *Client {
+	c.queryOptions = append(c.queryOptions, func(query *rcquery.Query) {
+		query.SetTimeLayout(layout)
+	})
+	return c
+}
+
+// RegisterQueryEncoder registers an encoder of query params for the type of sample
+// for all requests, see rcquery.Query.RegisterEncoder.
+func (c *Client) RegisterQueryEncoder(sample interface{}, encoder rcquery.EncoderFunc) *Client {
+	c.queryOptions = append(c.queryOptions, func(query *rcquery.Query) {
+		query.RegisterEncoder(sample, encoder)
+	})
+	return c
+}
+
+// AddHeader adds a default header, it is skipped if the request
+// adds a header with the same key.
+func (c *Client) AddHeader(key string, value string) *Client {
+	key = http.CanonicalHeaderKey(key)
+	c.header[key] = append(c.header[key], value)
+	return c
+}
+
+func (c *Client) AddBasicAuth(user string, pw string) *Client {
+	c.basicAuthUser = user
+	c.basicAuthPW = pw
+	return c
+}
+
+func (c *Client) AddRetryPolicy(policy RetryPolicy) *Client {
+	c.retryPolicy = &policy
+	return c
+}
+
+func (c *Client) Get(path string) *RestClient {
+	rc := c.newRC(path)
+	rc.requestMethod = http.MethodGet
+	return rc
+}
+
+func (c *Client) Post(path string) *RestClient {
+	rc := c.newRC(path)
+	rc.requestMethod = http.MethodPost
+	return rc
+}
+
+func (c *Client) Put(path string) *RestClient {
+	rc := c.newRC(path)
+	rc.requestMethod = http.MethodPut
+	return rc
+}
+
+func (c *Client) Delete(path string) *RestClient {
+	rc := c.newRC(path)
+	rc.requestMethod = http.MethodDelete
+	return rc
+}
+
+func (c *Client) Patch(path string) *RestClient {
+	rc := c.newRC(path)
+	rc.requestMethod = http.MethodPatch
+	return rc
+}
+
+func (c *Client) Head(path string) *RestClient {
+	rc := c.newRC(path)
+	rc.requestMethod = http.MethodHead
+	return rc
+}
+
+func (c *Client) Options(path string) *RestClient {
+	rc := c.newRC(path)
+	rc.requestMethod = http.MethodOptions
+	return rc
+}
+
+// Method creates a request with an arbitrary http method.
+func (c *Client) Method(method string, path string) *RestClient {
+	rc := c.newRC(path)
+	rc.requestMethod = method
+	return rc
+}
+
+func (c *Client) newRC(path string) *RestClient {
+	rc := newRC(c.url(path))
+	rc.pathTemplate = path
+	rc.client = c
+	if c.log != nil {
+		rc.log = c.log
+	}
+	rc.httpClient = c.httpClient
+	rc.basicAuthUser = c.basicAuthUser
+	rc.basicAuthPW = c.basicAuthPW
+	rc.retryPolicy = c.retryPolicy
+	rc.tokenSource = c.tokenSource
+	rc.signer = c.signer
+	rc.logConfig = c.logConfig
+	rc.secrets = append([]string(nil), c.secrets...)
+	for _, option := range c.queryOptions {
+		option(&rc.query)
+	}
+	return rc
+}
+
+func (c *Client) url(path string) string {
+	if c.baseURL == "" {
+		return path
+	}
+	if path == "" {
+		return c.baseURL
+	}
+	return strings.TrimRight(c.baseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,129 @@
+package restclient
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	jsonMediaType = "application/json"
+	xmlMediaType  = "application/xml"
+)
+
+// Codec encodes request bodies and decodes response bodies of a media type.
+type Codec interface {
+	// ContentType is the value of the Content-Type header of encoded request bodies.
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[string]Codec{
+		jsonMediaType: jsonCodec{},
+		xmlMediaType:  xmlCodec{},
+		"text/xml":    xmlCodec{},
+	}
+)
+
+// RegisterCodec registers the codec for the media type (e.g. application/yaml),
+// it replaces the registered codec of the media type, also the built-in
+// json and xml codecs.
+func RegisterCodec(mediaType string, codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	codecs[normalizeMediaType(mediaType)] = codec
+}
+
+// CodecFor returns the codec of the media type or content type. Media types
+// with a structured syntax suffix like application/problem+json fall back
+// to the codec of application/json or application/xml.
+func CodecFor(mediaType string) (Codec, bool) {
+	mediaType = normalizeMediaType(mediaType)
+
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	if codec, ok := codecs[mediaType]; ok {
+		return codec, true
+	}
+
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		codec, ok := codecs[jsonMediaType]
+		return codec, ok
+	case strings.HasSuffix(mediaType, "+xml"):
+		codec, ok := codecs[xmlMediaType]
+		return codec, ok
+	}
+	return nil, false
+}
+
+// acceptedMediaTypes returns the value of the Accept header for all registered codecs,
+// json and xml are preferred.
+func acceptedMediaTypes() string {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	mediaTypes := make([]string, 0, len(codecs))
+	for mediaType := range codecs {
+		if mediaType != jsonMediaType && mediaType != xmlMediaType {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	sort.Strings(mediaTypes)
+
+	return strings.Join(append([]string{jsonMediaType, xmlMediaType}, mediaTypes...), ", ")
+}
+
+// normalizeMediaType removes the parameters of a content type.
+func normalizeMediaType(contentTypeValue string) string {
+	mediaType, _, err := mime.ParseMediaType(contentTypeValue)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentTypeValue))
+	}
+	return mediaType
+}
+
+// unmarshal decodes data with the codec of the media type.
+func unmarshal(mediaType string, data []byte, v interface{}) error {
+	codec, ok := CodecFor(mediaType)
+	if !ok {
+		return &MediaTypeError{MediaType: mediaType}
+	}
+	return codec.Unmarshal(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return jsonContentType
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string {
+	return xmlContentType
+}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
@@ -0,0 +1,197 @@
+package restclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	contentEncoding = "Content-Encoding"
+	acceptEncoding  = "Accept-Encoding"
+)
+
+// DecompressorFunc creates a reader that decompresses the response body.
+type DecompressorFunc func(body io.Reader) (io.ReadCloser, error)
+
+var (
+	decompressorsMutex sync.RWMutex
+	decompressors      = map[string]DecompressorFunc{
+		"gzip":    newGzipReader,
+		"x-gzip":  newGzipReader,
+		"deflate": newDeflateReader,
+	}
+)
+
+// RegisterDecompressor registers a decompressor for the content encoding,
+// e.g. br or zstd.
+func RegisterDecompressor(encoding string, decompressor DecompressorFunc) {
+	decompressorsMutex.Lock()
+	defer decompressorsMutex.Unlock()
+
+	decompressors[strings.ToLower(encoding)] = decompressor
+}
+
+func decompressorFor(encoding string) (DecompressorFunc, bool) {
+	decompressorsMutex.RLock()
+	defer decompressorsMutex.RUnlock()
+
+	decompressor, ok := decompressors[strings.ToLower(strings.TrimSpace(encoding))]
+	return decompressor, ok
+}
+
+// acceptedEncodings returns the value of the Accept-Encoding header for all registered decompressors.
+func acceptedEncodings() string {
+	decompressorsMutex.RLock()
+	defer decompressorsMutex.RUnlock()
+
+	encodings := make([]string, 0, len(decompressors))
+	for encoding := range decompressors {
+		if encoding != "x-gzip" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	sort.Strings(encodings)
+	return strings.Join(encodings, ", ")
+}
+
+// CompressBody compresses the request body with gzip or deflate
+// and sets the Content-Encoding header.
+func (r *RestClient) CompressBody(encoding string) *RestClient {
+	// check for error
+	if r.err != nil {
+		return r
+	}
+
+	if encoding != "gzip" && encoding != "deflate" {
+		r.err = errors.New("restclient: unsupported request body compression " + encoding)
+		return r
+	}
+
+	r.compression = encoding
+	return r
+}
+
+// AcceptCompression sets the Accept-Encoding header to all registered
+// decompressors, the response body is decompressed automatically.
+func (r *RestClient) AcceptCompression() *RestClient {
+	r.header[acceptEncoding] = []string{acceptedEncodings()}
+	return r
+}
+
+func newCompressor(w io.Writer, encoding string) io.WriteCloser {
+	if encoding == "deflate" {
+		return zlib.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+// compress compresses a buffered body.
+func compress(body []byte, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+	compressor := newCompressor(&buf, encoding)
+
+	_, err := compressor.Write(body)
+	if err != nil {
+		return nil, err
+	}
+	err = compressor.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressStream compresses a streamed body while it's read.
+func compressStream(body io.ReadCloser, encoding string) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	go func() {
+		defer body.Close()
+
+		compressor := newCompressor(writer, encoding)
+		_, err := io.Copy(compressor, body)
+		if err == nil {
+			err = compressor.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	return reader
+}
+
+// decompress replaces the body of the response with the decompressed body,
+// if there is a decompressor for the content encoding.
+func decompress(response *http.Response) {
+	encoding := response.Header.Get(contentEncoding)
+	if encoding == "" {
+		return
+	}
+
+	decompressor, ok := decompressorFor(encoding)
+	if !ok {
+		return
+	}
+
+	response.Body = &decompressedBody{body: response.Body, decompressor: decompressor}
+	response.Header.Del(contentEncoding)
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+}
+
+// decompressedBody creates the decompressor on the first read,
+// so empty bodies (e.g. of HEAD requests) are no error.
+type decompressedBody struct {
+	body         io.ReadCloser
+	decompressor DecompressorFunc
+	reader       io.ReadCloser
+	err          error
+}
+
+func (d *decompressedBody) Read(p []byte) (int, error) {
+	if d.reader == nil && d.err == nil {
+		d.reader, d.err = d.decompressor(d.body)
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.reader.Read(p)
+}
+
+func (d *decompressedBody) Close() error {
+	if d.reader != nil {
+		d.reader.Close()
+	}
+	return d.body.Close()
+}
+
+func newGzipReader(body io.Reader) (io.ReadCloser, error) {
+	reader, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// newDeflateReader supports zlib wrapped (RFC 1950) and raw (RFC 1951) deflate.
+func newDeflateReader(body io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(body)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
@@ -0,0 +1,102 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Categories of failed requests, use errors.Is(result.Error(), ErrNotFound).
+var (
+	ErrNotFound     = errors.New("restclient: not found")
+	ErrUnauthorized = errors.New("restclient: unauthorized")
+	ErrServerError  = errors.New("restclient: server error")
+	ErrTimeout      = errors.New("restclient: timeout")
+)
+
+// HTTPError is the error of a failed response (status >= 400).
+type HTTPError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	Header     http.Header
+	Body       string
+	ErrorBody  interface{}
+	Problem    *Problem
+}
+
+func (e *HTTPError) Error() string {
+	if e.Problem != nil {
+		return e.Problem.Error()
+	}
+	if e.ErrorBody != nil {
+		return "[" + strconv.Itoa(e.StatusCode) + "]" + renderErrorBody(e.ErrorBody)
+	}
+	return "[" + strconv.Itoa(e.StatusCode) + "]" + e.Body
+}
+
+// Is matches the error categories ErrNotFound, ErrUnauthorized, ErrServerError and ErrTimeout.
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrServerError:
+		return e.StatusCode >= http.StatusInternalServerError
+	case ErrTimeout:
+		return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusGatewayTimeout
+	}
+	return false
+}
+
+// Unwrap returns the problem detail of the response, if there is one.
+func (e *HTTPError) Unwrap() error {
+	if e.Problem == nil {
+		return nil
+	}
+	return e.Problem
+}
+
+// timeoutError marks a transport error as ErrTimeout and keeps the original error.
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string {
+	return e.err.Error()
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+func (e *timeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// requestError returns the error of the context if the context is done,
+// so cancellation and deadlines are not hidden behind a transport error.
+// Timeouts are additionally marked as ErrTimeout.
+func requestError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &timeoutError{err: err}
+	}
+	return err
+}
+
+// MediaTypeError is returned if there is no codec for the media type of a body.
+type MediaTypeError struct {
+	MediaType string
+}
+
+func (e *MediaTypeError) Error() string {
+	return "restclient: no codec for media type " + strconv.Quote(e.MediaType)
+}
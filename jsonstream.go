@@ -0,0 +1,95 @@
+package restclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const ndjsonMediaType = "application/x-ndjson"
+
+// ErrStopIteration stops SendAndIterateJsonArray and SendAndIterateNDJson without an error.
+var ErrStopIteration = errors.New("restclient: stop iteration")
+
+// JsonItemFunc is called for every element of a json stream,
+// decode decodes the current element into v. Elements that are
+// not decoded are skipped.
+type JsonItemFunc func(decode func(v interface{}) error) error
+
+// SendAndIterateJsonArray decodes the elements of a json array response
+// one by one, without buffering the whole response body.
+func (r *RestClient) SendAndIterateJsonArray(fn JsonItemFunc) (result Result) {
+	r.accept(jsonMediaType)
+	return r.iterateJson(fn, true)
+}
+
+// SendAndIterateNDJson decodes the lines of a newline delimited json response
+// one by one, without buffering the whole response body.
+func (r *RestClient) SendAndIterateNDJson(fn JsonItemFunc) (result Result) {
+	r.accept(ndjsonMediaType)
+	return r.iterateJson(fn, false)
+}
+
+func (r *RestClient) iterateJson(fn JsonItemFunc, array bool) (result Result) {
+	body, result := r.SendAndStream()
+	if body == nil {
+		return
+	}
+	defer body.Close()
+
+	// decode only if there is something
+	if result.StatusCode < 200 || result.StatusCode >= 300 || r.requestMethod == http.MethodHead {
+		return
+	}
+
+	err := decodeJsonStream(json.NewDecoder(body), fn, array)
+	if err != nil && err != ErrStopIteration {
+		result.Err = requestError(r.context(), err)
+	}
+	return
+}
+
+func decodeJsonStream(dec *json.Decoder, fn JsonItemFunc, array bool) error {
+	if array {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if token != json.Delim('[') {
+			return errors.New("restclient: response is no json array")
+		}
+	}
+
+	for dec.More() {
+		decoded := false
+		err := fn(func(v interface{}) error {
+			if decoded {
+				return errors.New("restclient: json element is already decoded")
+			}
+			decoded = true
+			return dec.Decode(v)
+		})
+		if err != nil {
+			return err
+		}
+
+		// skip the element
+		if !decoded {
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if array {
+		_, err := dec.Token()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package restclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// LogLevel defines what is logged of a request.
+type LogLevel int
+
+const (
+	// LogOff logs nothing
+	LogOff LogLevel = iota
+	// LogSummary logs method, url, duration and status
+	LogSummary
+	// LogHeaders logs the summary and the request and response headers
+	LogHeaders
+	// LogFull logs the headers and the response body
+	// (and the request body, see LogConfig.LogRequestBody)
+	LogFull
+)
+
+// sensitiveHeaders are always redacted, additionally to LogConfig.RedactHeaders.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Amz-Security-Token",
+}
+
+// LogConfig configures the logging of requests. Redacted values are logged as ***.
+type LogConfig struct {
+	Level LogLevel
+	// RedactHeaders are redacted additionally to the Authorization, Proxy-Authorization,
+	// Cookie, Set-Cookie and X-Amz-Security-Token headers.
+	RedactHeaders []string
+	// RedactQueryParams are the query params with redacted values.
+	RedactQueryParams []string
+	// RedactJsonFields are the fields with redacted values in json bodies, on every level.
+	RedactJsonFields []string
+	// MaxBodyLength truncates logged bodies, 0 logs the whole body.
+	MaxBodyLength int
+	// LogRequestBody logs the request body on level LogFull.
+	LogRequestBody bool
+}
+
+// DefaultLogConfig logs everything except the values of sensitive headers.
+func DefaultLogConfig() LogConfig {
+	return LogConfig{Level: LogFull}
+}
+
+// SetLogConfig sets the log level and redactions of the request, default is DefaultLogConfig.
+func (r *RestClient) SetLogConfig(config LogConfig) *RestClient {
+	r.logConfig = &config
+	return r
+}
+
+// SetLogConfig sets the log level and redactions of all requests, default is DefaultLogConfig.
+func (c *Client) SetLogConfig(config LogConfig) *Client {
+	c.logConfig = &config
+	return c
+}
+
+func (r *RestClient) logLevel() LogLevel {
+	if r.logConfig == nil {
+		return LogFull
+	}
+	return r.logConfig.Level
+}
+
+// logf logs the message with all secrets redacted, if the level is enabled.
+func (r *RestClient) logf(level LogLevel, format string, v ...interface{}) {
+	if _, ok := r.log.(noLogger); ok || level > r.logLevel() {
+		return
+	}
+
+	msg := fmt.Sprintf(format, v...)
+	for _, secret := range r.secrets {
+		msg = strings.ReplaceAll(msg, secret, redacted)
+		msg = strings.ReplaceAll(msg, url.QueryEscape(secret), redacted)
+		msg = strings.ReplaceAll(msg, url.PathEscape(secret), redacted)
+	}
+	r.log.Printf("%s", msg)
+}
+
+func (r *RestClient) config() LogConfig {
+	if r.logConfig == nil {
+		return DefaultLogConfig()
+	}
+	return *r.logConfig
+}
+
+// lazyLog is an argument of logf that is only built if the message is logged.
+type lazyLog func() string
+
+func (l lazyLog) String() string {
+	return l()
+}
+
+// logURL redacts the configured query params of the url.
+func (r *RestClient) logURL(rawURL string) fmt.Stringer {
+	return lazyLog(func() string {
+		return r.redactURL(rawURL)
+	})
+}
+
+func (r *RestClient) redactURL(rawURL string) string {
+	params := r.config().RedactQueryParams
+	if len(params) == 0 {
+		return rawURL
+	}
+
+	fragment := ""
+	if i := strings.Index(rawURL, "#"); i >= 0 {
+		rawURL, fragment = rawURL[:i], rawURL[i:]
+	}
+	i := strings.Index(rawURL, "?")
+	if i < 0 {
+		return rawURL + fragment
+	}
+
+	query := strings.Split(rawURL[i+1:], "&")
+	for j, param := range query {
+		key := param
+		if k := strings.Index(param, "="); k >= 0 {
+			key = param[:k]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil && containsFold(params, unescaped) {
+			query[j] = key + "=" + redacted
+		}
+	}
+	return rawURL[:i+1] + strings.Join(query, "&") + fragment
+}
+
+// logHeader redacts the sensitive and the configured headers.
+func (r *RestClient) logHeader(header http.Header) fmt.Stringer {
+	return lazyLog(func() string {
+		return fmt.Sprint(r.redactHeader(header))
+	})
+}
+
+func (r *RestClient) redactHeader(header http.Header) http.Header {
+	redactHeaders := append(append([]string(nil), sensitiveHeaders...), r.config().RedactHeaders...)
+
+	logged := header.Clone()
+	for key, values := range logged {
+		if containsFold(redactHeaders, key) {
+			redactedValues := make([]string, len(values))
+			for i := range redactedValues {
+				redactedValues[i] = redacted
+			}
+			logged[key] = redactedValues
+		}
+	}
+	return logged
+}
+
+// logBody redacts the configured json fields and truncates the body.
+func (r *RestClient) logBody(body []byte) fmt.Stringer {
+	return lazyLog(func() string {
+		return r.redactBody(body)
+	})
+}
+
+func (r *RestClient) redactBody(body []byte) string {
+	config := r.config()
+
+	if len(config.RedactJsonFields) > 0 {
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if decoder.Decode(&value) == nil {
+			if redactedBody, err := json.Marshal(redactJson(value, config.RedactJsonFields)); err == nil {
+				body = redactedBody
+			}
+		}
+	}
+
+	if config.MaxBodyLength > 0 && len(body) > config.MaxBodyLength {
+		return string(body[:config.MaxBodyLength]) + "... (truncated, " + strconv.Itoa(len(body)) + " bytes)"
+	}
+	return string(body)
+}
+
+func redactJson(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if containsFold(fields, key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactJson(field, fields)
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = redactJson(elem, fields)
+		}
+	}
+	return value
+}
+
+func containsFold(list []string, value string) bool {
+	for _, elem := range list {
+		if strings.EqualFold(elem, value) {
+			return true
+		}
+	}
+	return false
+}
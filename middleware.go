@@ -0,0 +1,88 @@
+package restclient
+
+import (
+	"errors"
+	"net/http"
+)
+
+// errMissingResponse is returned if a middleware returns neither a response nor an error.
+var errMissingResponse = errors.New("restclient: middleware returned no response")
+
+// RoundTripFunc sends a request and returns its response.
+type RoundTripFunc func(request *http.Request) (*http.Response, error)
+
+// Middleware wraps the sending of a request, it can inspect and change
+// the request before calling next and the response afterwards.
+// Middlewares are called for every attempt of a request.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// AddMiddleware adds middlewares to the request, the first added middleware
+// is called first. Middlewares of the client are called before.
+func (r *RestClient) AddMiddleware(middlewares ...Middleware) *RestClient {
+	r.middlewares = append(r.middlewares, middlewares...)
+	return r
+}
+
+// AddMiddleware adds middlewares to all requests of the client,
+// the first added middleware is called first.
+func (c *Client) AddMiddleware(middlewares ...Middleware) *Client {
+	c.middlewares = append(c.middlewares, middlewares...)
+	return c
+}
+
+// BeforeRequest creates a middleware that is called before the request is sent,
+// an error aborts the request.
+func BeforeRequest(fn func(request *http.Request) error) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			err := fn(request)
+			if err != nil {
+				return nil, err
+			}
+			return next(request)
+		}
+	}
+}
+
+// AfterResponse creates a middleware that is called after the response is received,
+// an error discards the response.
+func AfterResponse(fn func(response *http.Response) error) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			response, err := next(request)
+			if err != nil {
+				return nil, err
+			}
+
+			err = fn(response)
+			if err != nil {
+				response.Body.Close()
+				return nil, err
+			}
+			return response, nil
+		}
+	}
+}
+
+// roundTrip builds the middleware chain around the http client,
+// the bearer token is set after all middlewares and the request
+// is signed at last.
+func (r *RestClient) roundTrip() RoundTripFunc {
+	roundTrip := send(r.httpClient)
+	if r.signer != nil {
+		roundTrip = signerMiddleware(r.signer)(roundTrip)
+	}
+	if r.tokenSource != nil {
+		roundTrip = tokenMiddleware(r.tokenSource)(roundTrip)
+	}
+
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		roundTrip = r.middlewares[i](roundTrip)
+	}
+	if r.client != nil {
+		for i := len(r.client.middlewares) - 1; i >= 0; i-- {
+			roundTrip = r.client.middlewares[i](roundTrip)
+		}
+	}
+	return roundTrip
+}
@@ -0,0 +1,202 @@
+package restclient
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type multipartBody struct {
+	parts    []multipartPart
+	boundary string
+}
+
+type multipartPart struct {
+	fieldName   string
+	value       string
+	isFile      bool
+	fileName    string
+	contentType string
+	reader      io.Reader
+	path        string
+}
+
+// AddMultipartBody adds the form fields to a multipart/form-data request body,
+// files can be added via AddFormFile and AddFormFilePath.
+// Only usable in Post/Put/Patch requests.
+func (r *RestClient) AddMultipartBody(fields url.Values) *RestClient {
+	// check for error
+	if r.err != nil {
+		return r
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	r.multipartBody()
+	for _, key := range keys {
+		for _, value := range fields[key] {
+			r.AddFormField(key, value)
+		}
+	}
+	return r
+}
+
+// AddFormField adds a form field to a multipart/form-data request body.
+// Only usable in Post/Put/Patch requests.
+func (r *RestClient) AddFormField(name string, value string) *RestClient {
+	// check for error
+	if r.err != nil {
+		return r
+	}
+
+	body := r.multipartBody()
+	body.parts = append(body.parts, multipartPart{fieldName: name, value: value})
+	return r
+}
+
+// AddFormFile adds a file to a multipart/form-data request body, the content
+// is streamed while sending and the request can't be retried. Without a
+// content type, it's detected by the extension of the file name.
+// Only usable in Post/Put/Patch requests.
+func (r *RestClient) AddFormFile(fieldName string, fileName string, content io.Reader, contentType string) *RestClient {
+	// check for error
+	if r.err != nil {
+		return r
+	}
+
+	body := r.multipartBody()
+	body.parts = append(body.parts, multipartPart{
+		fieldName:   fieldName,
+		isFile:      true,
+		fileName:    fileName,
+		contentType: contentType,
+		reader:      content,
+	})
+	return r
+}
+
+// AddFormFilePath adds a file from disk to a multipart/form-data request body,
+// the file is streamed while sending. The content type is detected by the
+// extension of the file.
+// Only usable in Post/Put/Patch requests.
+func (r *RestClient) AddFormFilePath(fieldName string, path string) *RestClient {
+	// check for error
+	if r.err != nil {
+		return r
+	}
+
+	_, r.err = os.Stat(path)
+	if r.err != nil {
+		return r
+	}
+
+	body := r.multipartBody()
+	body.parts = append(body.parts, multipartPart{
+		fieldName: fieldName,
+		isFile:    true,
+		fileName:  filepath.Base(path),
+		path:      path,
+	})
+	return r
+}
+
+func (r *RestClient) multipartBody() *multipartBody {
+	if r.multipart == nil {
+		r.multipart = &multipartBody{}
+		r.requestBody = nil
+	}
+	return r.multipart
+}
+
+// replayable reports if the body can be sent more than once,
+// files from an io.Reader can only be read once.
+func (m *multipartBody) replayable() bool {
+	for _, part := range m.parts {
+		if part.reader != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// open returns the body and its content type, the body is written while it's read.
+// Every opened body uses the same boundary, so a replayed body matches the
+// content type of the request.
+func (m *multipartBody) open() (io.ReadCloser, string) {
+	if m.boundary == "" {
+		m.boundary = multipart.NewWriter(nil).Boundary()
+	}
+
+	reader, writer := io.Pipe()
+	mw := multipart.NewWriter(writer)
+	mw.SetBoundary(m.boundary)
+
+	go func() {
+		writer.CloseWithError(m.write(mw))
+	}()
+
+	return reader, mw.FormDataContentType()
+}
+
+func (m *multipartBody) write(mw *multipart.Writer) error {
+	for _, part := range m.parts {
+		if !part.isFile {
+			err := mw.WriteField(part.fieldName, part.value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := part.writeFile(mw)
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (p *multipartPart) writeFile(mw *multipart.Writer) error {
+	content := p.reader
+	if p.path != "" {
+		file, err := os.Open(p.path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		content = file
+	}
+
+	contentTypeValue := p.contentType
+	if contentTypeValue == "" {
+		contentTypeValue = mime.TypeByExtension(filepath.Ext(p.fileName))
+	}
+	if contentTypeValue == "" {
+		contentTypeValue = "application/octet-stream"
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(p.fieldName), quoteEscaper.Replace(p.fileName)))
+	header.Set(contentType, contentTypeValue)
+
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
@@ -0,0 +1,70 @@
+package restclient
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var pathParamPattern = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// PathParam fills the placeholder {name} of the path template,
+// the value is escaped as a single path segment and must not be empty.
+func (r *RestClient) PathParam(name string, value interface{}) *RestClient {
+	if r.pathParams == nil {
+		r.pathParams = make(map[string]string)
+	}
+	r.pathParams[name] = fmt.Sprint(value)
+	return r
+}
+
+// PathTemplate returns the path of the request without filled path params,
+// e.g. /users/{id}. It's usable as a label for logging and metrics.
+func (r *RestClient) PathTemplate() string {
+	return r.pathTemplate
+}
+
+// fillPath replaces all placeholders of the path, every placeholder
+// needs a non empty path param and every path param needs a placeholder.
+func fillPath(path string, params map[string]string) (string, error) {
+	used := make(map[string]bool)
+	var missing []string
+	var empty []string
+
+	filled := pathParamPattern.ReplaceAllStringFunc(path, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		value, ok := params[name]
+		if !ok {
+			missing = append(missing, name)
+			return placeholder
+		}
+		used[name] = true
+		if value == "" {
+			empty = append(empty, name)
+		}
+		return url.PathEscape(value)
+	})
+
+	if len(missing) > 0 {
+		return "", errors.New("restclient: missing path params " + strings.Join(missing, ", ") + " of " + path)
+	}
+	if len(empty) > 0 {
+		return "", errors.New("restclient: empty path params " + strings.Join(empty, ", ") + " of " + path)
+	}
+
+	var unknown []string
+	for name := range params {
+		if !used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", errors.New("restclient: unknown path params " + strings.Join(unknown, ", ") + " of " + path)
+	}
+
+	return filled, nil
+}
@@ -0,0 +1,73 @@
+package restclient
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const problemMediaType = "application/problem+json"
+
+// Problem is the problem detail of a failed response (RFC 7807),
+// it's available as Result.Problem if the response has the
+// content type application/problem+json.
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extensions contains all additional members of the problem detail.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+var problemMembers = []string{"type", "title", "status", "detail", "instance"}
+
+// problemFields is used to decode the standard members without recursion.
+type problemFields Problem
+
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var fields problemFields
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+
+	var members map[string]interface{}
+	err = json.Unmarshal(data, &members)
+	if err != nil {
+		return err
+	}
+	// the standard members are matched case-insensitive like encoding/json does
+	for key := range members {
+		for _, member := range problemMembers {
+			if strings.EqualFold(key, member) {
+				delete(members, key)
+			}
+		}
+	}
+
+	*p = Problem(fields)
+	if len(members) > 0 {
+		p.Extensions = members
+	}
+	return nil
+}
+
+func (p *Problem) Error() string {
+	msg := "[" + strconv.Itoa(p.Status) + "]" + p.Title
+	if p.Detail != "" {
+		if p.Title != "" {
+			msg += ": "
+		}
+		msg += p.Detail
+	}
+	return msg
+}
+
+func isProblem(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get(contentType))
+	return err == nil && mediaType == problemMediaType
+}
@@ -0,0 +1,98 @@
+package rcquery
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// EncoderFunc encodes a value of a registered type into a query value,
+// the result is escaped afterwards.
+type EncoderFunc func(value interface{}) (string, error)
+
+var (
+	encodersMutex sync.RWMutex
+	encoders      = make(map[reflect.Type]EncoderFunc)
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// RegisterEncoder registers an encoder for the type of sample for all queries.
+func RegisterEncoder(sample interface{}, encoder EncoderFunc) {
+	encodersMutex.Lock()
+	defer encodersMutex.Unlock()
+
+	encoders[reflect.TypeOf(sample)] = encoder
+}
+
+func globalEncoder(typ reflect.Type) (EncoderFunc, bool) {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+
+	encoder, ok := encoders[typ]
+	return encoder, ok
+}
+
+// RegisterEncoder registers an encoder for the type of sample for this query,
+// it overrides the encoders registered via the package function RegisterEncoder.
+func (q *Query) RegisterEncoder(sample interface{}, encoder EncoderFunc) *Query {
+	if q.encoders == nil {
+		q.encoders = make(map[reflect.Type]EncoderFunc)
+	}
+	q.encoders[reflect.TypeOf(sample)] = encoder
+	return q
+}
+
+// encode encodes registered types, time.Time, time.Duration and values implementing
+// encoding.TextMarshaler or fmt.Stringer. ok is false for all other values.
+func (q *Query) encode(val reflect.Value) (value string, ok bool, err error) {
+	if !val.CanInterface() {
+		return "", false, nil
+	}
+
+	if encoder, found := q.encoders[val.Type()]; found {
+		value, err = encoder(val.Interface())
+		return value, true, err
+	}
+	if encoder, found := globalEncoder(val.Type()); found {
+		value, err = encoder(val.Interface())
+		return value, true, err
+	}
+
+	switch val.Type() {
+	case timeType:
+		layout := q.timeLayout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return val.Interface().(time.Time).Format(layout), true, nil
+
+	case durationType:
+		return val.Interface().(time.Duration).String(), true, nil
+	}
+
+	// methods with pointer receiver
+	candidates := []reflect.Value{val}
+	if val.CanAddr() {
+		candidates = append(candidates, val.Addr())
+	}
+
+	for _, candidate := range candidates {
+		if marshaler, found := candidate.Interface().(encoding.TextMarshaler); found {
+			text, err := marshaler.MarshalText()
+			return string(text), true, err
+		}
+	}
+	for _, candidate := range candidates {
+		if stringer, found := candidate.Interface().(fmt.Stringer); found {
+			return stringer.String(), true, nil
+		}
+	}
+
+	return "", false, nil
+}
@@ -1,59 +1,529 @@
 package rcquery
 
 import (
+	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// KeyStyle defines how the keys of nested struct fields and map entries are built.
+type KeyStyle int
+
+const (
+	// DotKeys builds nested keys like filter.name
+	DotKeys KeyStyle = iota
+	// BracketKeys builds nested keys like filter[name]
+	BracketKeys
+)
+
+// ArrayFormat defines how slices and arrays are encoded,
+// the formats match the OpenAPI style/explode settings.
+type ArrayFormat int
+
+const (
+	// RepeatArray encodes like ids=1&ids=2 (form, explode=true)
+	RepeatArray ArrayFormat = iota
+	// CommaArray encodes like ids=1,2 (form, explode=false)
+	CommaArray
+	// SpaceArray encodes like ids=1%202 (spaceDelimited)
+	SpaceArray
+	// PipeArray encodes like ids=1|2 (pipeDelimited)
+	PipeArray
+	// BracketArray encodes like ids[]=1&ids[]=2
+	BracketArray
+	// IndexArray encodes like ids[0]=1&ids[1]=2
+	IndexArray
+)
+
+var arrayFormatTags = map[string]ArrayFormat{
+	"repeat":   RepeatArray,
+	"comma":    CommaArray,
+	"space":    SpaceArray,
+	"pipe":     PipeArray,
+	"brackets": BracketArray,
+	"indexed":  IndexArray,
+}
+
 type Query struct {
-	query string
+	params      []param
+	keyStyle    KeyStyle
+	arrayFormat ArrayFormat
+	timeLayout  string
+	encoders    map[reflect.Type]EncoderFunc
+	err         error
+}
+
+// param is a single query param, the value is already escaped.
+type param struct {
+	key     string
+	value   string
+	noValue bool
 }
 
 func New() *Query {
 	return &Query{}
 }
 
+// Parse parses a query string (with or without a leading '?') into a Query,
+// the order of the params is kept.
+func Parse(rawQuery string) (*Query, error) {
+	q := New()
+	for _, part := range strings.Split(strings.TrimPrefix(rawQuery, "?"), "&") {
+		if part == "" {
+			continue
+		}
+
+		key, value, noValue := part, "", true
+		if i := strings.Index(part, "="); i >= 0 {
+			key, value, noValue = part[:i], part[i+1:], false
+		}
+
+		unescapedKey, err := url.QueryUnescape(key)
+		if err != nil {
+			return nil, fmt.Errorf("rcquery: invalid key %q: %v", key, err)
+		}
+		if _, err = url.QueryUnescape(value); err != nil {
+			return nil, fmt.Errorf("rcquery: invalid value of key %q: %v", unescapedKey, err)
+		}
+		q.params = append(q.params, param{key: unescapedKey, value: value, noValue: noValue})
+	}
+	return q, nil
+}
+
+// Clone returns a copy of the query with the same params and settings.
+func (q *Query) Clone() *Query {
+	clone := *q
+	clone.params = append([]param(nil), q.params...)
+	if q.encoders != nil {
+		clone.encoders = make(map[reflect.Type]EncoderFunc, len(q.encoders))
+		for typ, encoder := range q.encoders {
+			clone.encoders[typ] = encoder
+		}
+	}
+	return &clone
+}
+
+// SetKeyStyle sets the style of nested keys, default is DotKeys.
+func (q *Query) SetKeyStyle(style KeyStyle) *Query {
+	q.keyStyle = style
+	return q
+}
+
+// SetArrayFormat sets the default format of slices and arrays, default is RepeatArray.
+func (q *Query) SetArrayFormat(format ArrayFormat) *Query {
+	q.arrayFormat = format
+	return q
+}
+
+// SetTimeLayout sets the layout of time.Time values, default is time.RFC3339.
+func (q *Query) SetTimeLayout(layout string) *Query {
+	q.timeLayout = layout
+	return q
+}
+
 func (q *Query) Add(key string, value interface{}) *Query {
+	return q.AddArray(key, value, q.arrayFormat)
+}
+
+// AddArray adds a query param and encodes slices and arrays with the given format.
+func (q *Query) AddArray(key string, value interface{}, format ArrayFormat) *Query {
+	// ignore nil values
+	if value == nil {
+		return q
+	}
+
+	q.add(key, reflect.ValueOf(value), format)
+	return q
+}
+
+// Set replaces all query params with the key.
+func (q *Query) Set(key string, value interface{}) *Query {
+	return q.Del(key).Add(key, value)
+}
+
+// Del removes all query params with the key.
+func (q *Query) Del(key string) *Query {
+	params := q.params[:0]
+	for _, p := range q.params {
+		if p.key != key {
+			params = append(params, p)
+		}
+	}
+	q.params = params
+	return q
+}
+
+// Has reports if there is a query param with the key.
+func (q *Query) Has(key string) bool {
+	for _, p := range q.params {
+		if p.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// AddStruct adds all fields of a struct as query params.
+// The key of a field is defined by the tag `query:"name,omitempty"`,
+// without a tag the field name is used and `query:"-"` ignores the field.
+// The array format of a field can be set with the tag options repeat,
+// comma, space, pipe, brackets and indexed, e.g. `query:"id,comma"`.
+// Nested structs are added with nested keys (see SetKeyStyle),
+// the fields of embedded structs are added without a prefix.
+// Other types than structs are an error.
+func (q *Query) AddStruct(value interface{}) *Query {
 	// ignore nil values
 	if value == nil {
 		return q
 	}
 
-	var separator string
-	if len(q.query) == 0 {
-		separator = "?"
-	} else {
-		separator = "&"
+	val := reflect.Indirect(reflect.ValueOf(value))
+	if !val.IsValid() {
+		return q
+	}
+	if val.Kind() != reflect.Struct {
+		q.setErr(fmt.Errorf("rcquery: %s is no struct", val.Type()))
+		return q
+	}
+	q.addFields("", val)
+	return q
+}
+
+// AddMap adds all entries of a map (e.g. map[string]string or url.Values)
+// as query params, sorted by key.
+func (q *Query) AddMap(value interface{}) *Query {
+	// ignore nil values
+	if value == nil {
+		return q
 	}
 
 	val := reflect.Indirect(reflect.ValueOf(value))
+	if !val.IsValid() {
+		return q
+	}
+	if val.Kind() != reflect.Map {
+		q.setErr(fmt.Errorf("rcquery: %s is no map", val.Type()))
+		return q
+	}
+	q.addEntries("", val)
+	return q
+}
+
+// Err returns the first error of the added query params, e.g. of an unsupported type.
+func (q *Query) Err() error {
+	return q.err
+}
+
+func (q *Query) setErr(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *Query) add(key string, value reflect.Value, format ArrayFormat) {
+	val := reflect.Indirect(value)
+
+	if v, ok, err := q.formatValue(val); ok {
+		if err != nil {
+			q.setErr(fmt.Errorf("rcquery: can't encode query param %s: %v", key, err))
+			return
+		}
+		q.append(key, v)
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Array, reflect.Slice:
+		q.addArray(key, val, format)
+
+	case reflect.Struct:
+		q.addFields(key, val)
+
+	case reflect.Map:
+		q.addEntries(key, val)
+
+	case reflect.Interface:
+		if !val.IsNil() {
+			q.add(key, val.Elem(), format)
+		}
+
+	case reflect.Invalid:
+		// nil pointer will ignored
+
+	default:
+		q.setErr(fmt.Errorf("rcquery: unsupported type %s of query param %s", val.Type(), key))
+	}
+}
+
+func (q *Query) addArray(key string, val reflect.Value, format ArrayFormat) {
+	switch format {
+	case CommaArray, SpaceArray, PipeArray:
+		values := make([]string, 0, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			elem := reflect.Indirect(val.Index(i))
+			if elem.Kind() == reflect.Interface {
+				elem = reflect.Indirect(elem.Elem())
+			}
+			if !elem.IsValid() {
+				continue
+			}
+
+			v, ok, err := q.formatValue(elem)
+			if !ok {
+				q.setErr(fmt.Errorf("rcquery: type %s of query param %s can't be delimited", elem.Type(), key))
+				return
+			}
+			if err != nil {
+				q.setErr(fmt.Errorf("rcquery: can't encode query param %s: %v", key, err))
+				return
+			}
+			values = append(values, v)
+		}
+		if len(values) > 0 {
+			q.append(key, strings.Join(values, delimiter(format)))
+		}
+
+	case BracketArray:
+		for i := 0; i < val.Len(); i++ {
+			q.add(key+"[]", val.Index(i), format)
+		}
+
+	case IndexArray:
+		for i := 0; i < val.Len(); i++ {
+			q.add(key+"["+strconv.Itoa(i)+"]", val.Index(i), format)
+		}
+
+	default:
+		for i := 0; i < val.Len(); i++ {
+			q.add(key, val.Index(i), format)
+		}
+	}
+}
+
+// formatValue returns the escaped value of simple types and
+// of types supported by encode.
+func (q *Query) formatValue(val reflect.Value) (value string, ok bool, err error) {
+	if !val.IsValid() {
+		return "", false, nil
+	}
+
+	if value, ok, err = q.encode(val); ok {
+		return url.QueryEscape(value), true, err
+	}
+
 	switch val.Kind() {
 	case reflect.Bool:
-		q.query += separator + key + "=" + strconv.FormatBool(val.Bool())
+		return strconv.FormatBool(val.Bool()), true, nil
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		q.query += separator + key + "=" + strconv.FormatInt(val.Int(), 10)
+		return strconv.FormatInt(val.Int(), 10), true, nil
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		q.query += separator + key + "=" + strconv.FormatUint(val.Uint(), 10)
+		return strconv.FormatUint(val.Uint(), 10), true, nil
 
 	case reflect.Float32, reflect.Float64:
-		q.query += separator + key + "=" + strconv.FormatFloat(val.Float(), 'f', -1, 64)
+		return strconv.FormatFloat(val.Float(), 'f', -1, 64), true, nil
 
 	case reflect.String:
-		q.query += separator + key + "=" + url.QueryEscape(val.String())
+		return url.QueryEscape(val.String()), true, nil
+	}
+	return "", false, nil
+}
 
-	case reflect.Array, reflect.Slice:
-		for i := 0; i < val.Len(); i++ {
-			q.Add(key, val.Index(i).Interface())
+func (q *Query) append(key string, value string) {
+	q.params = append(q.params, param{key: key, value: value})
+}
+
+// addEntries adds the entries of a map sorted by key, to get deterministic urls.
+func (q *Query) addEntries(prefix string, val reflect.Value) {
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, val.Len())
+	iter := val.MapRange()
+	for iter.Next() {
+		key, ok := formatKey(iter.Key())
+		if !ok {
+			q.setErr(fmt.Errorf("rcquery: unsupported map key type %s", iter.Key().Type()))
+			return
 		}
-	default:
-		// will ignored
+		entries = append(entries, entry{key: key, value: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	for _, e := range entries {
+		q.add(q.nestedKey(prefix, e.key), e.value, q.arrayFormat)
 	}
-	return q
 }
 
+func (q *Query) addFields(prefix string, val reflect.Value) {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldValue := val.Field(i)
+
+		tag, ok := parseTag(field, q.arrayFormat)
+		if !ok {
+			continue
+		}
+
+		// embedded structs without a name share the prefix
+		if field.Anonymous && field.Tag.Get("query") == "" {
+			embedded := reflect.Indirect(fieldValue)
+			if embedded.Kind() == reflect.Struct {
+				q.addFields(prefix, embedded)
+				continue
+			}
+		}
+
+		// unexported fields are ignored
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if tag.omitEmpty && isEmpty(fieldValue) {
+			continue
+		}
+
+		q.add(q.nestedKey(prefix, tag.name), fieldValue, tag.arrayFormat)
+	}
+}
+
+func (q *Query) nestedKey(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	if q.keyStyle == BracketKeys {
+		return prefix + "[" + name + "]"
+	}
+	return prefix + "." + name
+}
+
+// Get returns the escaped query string with a leading '?',
+// or an empty string if there are no query params.
 func (q *Query) Get() string {
-	return q.query
+	if len(q.params) == 0 {
+		return ""
+	}
+
+	var query strings.Builder
+	for i, p := range q.params {
+		if i == 0 {
+			query.WriteByte('?')
+		} else {
+			query.WriteByte('&')
+		}
+		query.WriteString(escapeKey(p.key))
+		if !p.noValue {
+			query.WriteByte('=')
+			query.WriteString(p.value)
+		}
+	}
+	return query.String()
+}
+
+// Merge adds the query params to the query of rawURL, the existing
+// query and the fragment of rawURL are kept unchanged.
+func (q *Query) Merge(rawURL string) (string, error) {
+	fragment := ""
+	if i := strings.Index(rawURL, "#"); i >= 0 {
+		rawURL, fragment = rawURL[:i], rawURL[i:]
+	}
+
+	rawQuery := ""
+	if i := strings.Index(rawURL, "?"); i >= 0 {
+		rawQuery = rawURL[i+1:]
+	}
+
+	_, err := Parse(rawQuery)
+	if err != nil {
+		return "", err
+	}
+	if len(q.params) == 0 {
+		return rawURL + fragment, nil
+	}
+
+	query := q.Get()
+	if strings.Contains(rawURL, "?") {
+		query = query[1:]
+		if rawQuery != "" && !strings.HasSuffix(rawQuery, "&") {
+			query = "&" + query
+		}
+	}
+	return rawURL + query + fragment, nil
+}
+
+type fieldTag struct {
+	name        string
+	omitEmpty   bool
+	arrayFormat ArrayFormat
+}
+
+// parseTag returns the options of the query tag, ok is false if the field should be ignored.
+func parseTag(field reflect.StructField, arrayFormat ArrayFormat) (tag fieldTag, ok bool) {
+	value := field.Tag.Get("query")
+	if value == "-" {
+		return tag, false
+	}
+
+	parts := strings.Split(value, ",")
+	tag.name = parts[0]
+	if tag.name == "" {
+		tag.name = field.Name
+	}
+	tag.arrayFormat = arrayFormat
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			tag.omitEmpty = true
+		}
+		if format, ok := arrayFormatTags[option]; ok {
+			tag.arrayFormat = format
+		}
+	}
+	return tag, true
+}
+
+// escapeKey escapes the key like a value, but keeps the brackets
+// of nested keys and array formats readable.
+func escapeKey(key string) string {
+	return keyEscaper.Replace(url.QueryEscape(key))
+}
+
+var keyEscaper = strings.NewReplacer("%5B", "[", "%5D", "]")
+
+func delimiter(format ArrayFormat) string {
+	switch format {
+	case SpaceArray:
+		return "%20"
+	case PipeArray:
+		return "|"
+	}
+	return ","
+}
+
+func formatKey(key reflect.Value) (string, bool) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(key.Uint(), 10), true
+	}
+	return "", false
+}
+
+func isEmpty(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		return val.Len() == 0
+	}
+	return val.IsZero()
 }
@@ -1,8 +1,13 @@
 package rcquery_test
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/maprost/restclient/rcquery"
 	"github.com/maprost/should"
@@ -22,7 +27,7 @@ func TestAllQueryTypes(t *testing.T) {
 		Add("pList", []int{1, 2, 3}).
 		Add("crap", map[string]string{"not": "in"}).
 		Get()
-	should.BeEqual(t, query, "?Blob=Crop&Limit=23&Flag=true&kilo=-12.123456789&pList=1&pList=2&pList=3")
+	should.BeEqual(t, query, "?Blob=Crop&Limit=23&Flag=true&kilo=-12.123456789&pList=1&pList=2&pList=3&crap.not=in")
 }
 
 func TestEscapeQuery(t *testing.T) {
@@ -47,3 +52,261 @@ func TestNilTypes(t *testing.T) {
 		Get()
 	should.BeEqual(t, query, "?Query=nil&FlagI=0")
 }
+
+func TestStructQuery(t *testing.T) {
+	type Paging struct {
+		Limit  int `query:"limit"`
+		Offset int `query:"offset,omitempty"`
+	}
+	type Range struct {
+		From int `query:"from"`
+		To   int `query:"to,omitempty"`
+	}
+	type Filter struct {
+		Paging
+		Name    string   `query:"name,omitempty"`
+		Email   *string  `query:"email"`
+		IDs     []int    `query:"id"`
+		Tags    []string `query:"tag,omitempty"`
+		Age     Range    `query:"age"`
+		Flag    *bool
+		Ignored string `query:"-"`
+		private string
+	}
+
+	flag := true
+	filter := Filter{
+		Paging:  Paging{Limit: 10},
+		IDs:     []int{1, 2},
+		Age:     Range{From: 18},
+		Flag:    &flag,
+		Ignored: "blob",
+		private: "crop",
+	}
+
+	query := rcquery.New().AddStruct(filter).Get()
+	should.BeEqual(t, query, "?limit=10&id=1&id=2&age.from=18&Flag=true")
+
+	query = rcquery.New().SetKeyStyle(rcquery.BracketKeys).AddStruct(&filter).Get()
+	should.BeEqual(t, query, "?limit=10&id=1&id=2&age[from]=18&Flag=true")
+
+	query = rcquery.New().Add("filter", Range{From: 1, To: 2}).Get()
+	should.BeEqual(t, query, "?filter.from=1&filter.to=2")
+}
+
+func TestMapQuery(t *testing.T) {
+	query := rcquery.New().
+		AddMap(map[string]string{"name": "Blob", "email": "blob@crop.de", "age": "12"}).
+		AddMap(url.Values{"tag": {"a", "b"}, "id": {"1"}}).
+		Add("filter", map[int]bool{2: true, 1: false})
+	should.BeNil(t, query.Err())
+	should.BeEqual(t, query.Get(), "?age=12&email=blob%40crop.de&name=Blob&id=1&tag=a&tag=b&filter.1=false&filter.2=true")
+}
+
+func TestUnsupportedQueryTypes(t *testing.T) {
+	query := rcquery.New().Add("Blob", "Crop").Add("func", func() {})
+	should.NotBeNil(t, query.Err())
+	should.BeEqual(t, query.Get(), "?Blob=Crop")
+
+	query = rcquery.New().Add("complex", complex(1, 2))
+	should.NotBeNil(t, query.Err())
+
+	query = rcquery.New().AddMap(map[float64]string{1.2: "Crop"})
+	should.NotBeNil(t, query.Err())
+
+	query = rcquery.New().AddMap([]string{"Crop"})
+	should.NotBeNil(t, query.Err())
+
+	query = rcquery.New().AddMap((*url.Values)(nil))
+	should.BeNil(t, query.Err())
+	should.BeEqual(t, query.Get(), "")
+
+	query = rcquery.New().AddStruct("a=b")
+	should.NotBeNil(t, query.Err())
+	should.BeEqual(t, query.Get(), "")
+}
+
+func TestArrayFormats(t *testing.T) {
+	ids := []int{1, 2, 3}
+
+	should.BeEqual(t, rcquery.New().Add("ids", ids).Get(), "?ids=1&ids=2&ids=3")
+	should.BeEqual(t, rcquery.New().SetArrayFormat(rcquery.CommaArray).Add("ids", ids).Get(), "?ids=1,2,3")
+	should.BeEqual(t, rcquery.New().SetArrayFormat(rcquery.SpaceArray).Add("ids", ids).Get(), "?ids=1%202%203")
+	should.BeEqual(t, rcquery.New().SetArrayFormat(rcquery.PipeArray).Add("ids", ids).Get(), "?ids=1|2|3")
+	should.BeEqual(t, rcquery.New().SetArrayFormat(rcquery.BracketArray).Add("ids", ids).Get(), "?ids[]=1&ids[]=2&ids[]=3")
+	should.BeEqual(t, rcquery.New().SetArrayFormat(rcquery.IndexArray).Add("ids", ids).Get(), "?ids[0]=1&ids[1]=2&ids[2]=3")
+
+	query := rcquery.New().
+		SetArrayFormat(rcquery.BracketArray).
+		Add("ids", ids).
+		AddArray("tags", []string{"a,b", "c"}, rcquery.CommaArray).
+		AddArray("empty", []string{}, rcquery.CommaArray)
+	should.BeNil(t, query.Err())
+	should.BeEqual(t, query.Get(), "?ids[]=1&ids[]=2&ids[]=3&tags=a%2Cb,c")
+}
+
+func TestArrayFormatTags(t *testing.T) {
+	type Filter struct {
+		IDs    []int    `query:"id,comma"`
+		Tags   []string `query:"tag,omitempty,brackets"`
+		Colors []string `query:"color,pipe"`
+		Names  []string `query:"name"`
+	}
+
+	query := rcquery.New().
+		SetArrayFormat(rcquery.IndexArray).
+		AddStruct(Filter{IDs: []int{1, 2}, Tags: []string{"a"}, Colors: []string{"blue", "black"}, Names: []string{"Blob"}})
+	should.BeNil(t, query.Err())
+	should.BeEqual(t, query.Get(), "?id=1,2&tag[]=a&color=blue|black&name[0]=Blob")
+}
+
+func TestArrayFormatNotDelimitable(t *testing.T) {
+	type Range struct {
+		From int
+	}
+
+	query := rcquery.New().AddArray("range", []Range{{From: 1}}, rcquery.CommaArray)
+	should.NotBeNil(t, query.Err())
+}
+
+type userID int
+
+func (id userID) String() string {
+	return "user-" + strconv.Itoa(int(id))
+}
+
+type color struct {
+	r, g, b uint8
+}
+
+func (c *color) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("#%02x%02x%02x", c.r, c.g, c.b)), nil
+}
+
+type broken struct{}
+
+func (broken) MarshalText() ([]byte, error) {
+	return nil, errors.New("broken")
+}
+
+func TestTimeQuery(t *testing.T) {
+	changed := time.Date(2017, 3, 12, 14, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	query := rcquery.New().Add("changed", changed).Add("timeout", 90*time.Second).Add("nil", (*time.Time)(nil))
+	should.BeNil(t, query.Err())
+	should.BeEqual(t, query.Get(), "?changed=2017-03-12T14%3A30%3A00%2B01%3A00&timeout=1m30s")
+
+	query = rcquery.New().SetTimeLayout("2006-01-02").Add("day", &changed)
+	should.BeEqual(t, query.Get(), "?day=2017-03-12")
+}
+
+func TestMarshalerQuery(t *testing.T) {
+	type Filter struct {
+		User   userID    `query:"user"`
+		Users  []userID  `query:"users,comma"`
+		Color  color     `query:"color"`
+		Since  time.Time `query:"since,omitempty"`
+		Broken *broken   `query:"broken"`
+	}
+
+	query := rcquery.New().AddStruct(&Filter{User: 1, Users: []userID{2, 3}, Color: color{r: 255}})
+	should.BeNil(t, query.Err())
+	should.BeEqual(t, query.Get(), "?user=user-1&users=user-2,user-3&color=%23ff0000")
+
+	query = rcquery.New().Add("broken", broken{})
+	should.NotBeNil(t, query.Err())
+}
+
+func TestCustomEncoder(t *testing.T) {
+	type cents int64
+
+	rcquery.RegisterEncoder(cents(0), func(value interface{}) (string, error) {
+		c := value.(cents)
+		return fmt.Sprintf("%d.%02d", c/100, c%100), nil
+	})
+
+	query := rcquery.New().Add("price", cents(1250))
+	should.BeEqual(t, query.Get(), "?price=12.50")
+
+	query = rcquery.New().
+		RegisterEncoder(cents(0), func(value interface{}) (string, error) {
+			return "free", nil
+		}).
+		Add("price", cents(0))
+	should.BeEqual(t, query.Get(), "?price=free")
+
+	clone := query.Clone().RegisterEncoder(cents(0), func(value interface{}) (string, error) {
+		return "gratis", nil
+	})
+	should.BeEqual(t, clone.Add("discount", cents(0)).Get(), "?price=free&discount=gratis")
+	should.BeEqual(t, query.Add("discount", cents(0)).Get(), "?price=free&discount=free")
+}
+
+func TestEscapeKey(t *testing.T) {
+	query := rcquery.New().Add("$ü key", 1).Add("filter[name]", "Blob")
+	should.BeEqual(t, query.Get(), "?%24%C3%BC+key=1&filter[name]=Blob")
+}
+
+func TestSetDelHas(t *testing.T) {
+	query := rcquery.New().Add("limit", 1).Add("id", []int{1, 2}).Add("name", "Blob")
+	should.BeTrue(t, query.Has("id"))
+	should.BeFalse(t, query.Has("offset"))
+
+	query.Set("limit", 10).Del("id")
+	should.BeFalse(t, query.Has("id"))
+	should.BeEqual(t, query.Get(), "?name=Blob&limit=10")
+
+	query.Del("name").Del("limit")
+	should.BeEqual(t, query.Get(), "")
+}
+
+func TestParseQuery(t *testing.T) {
+	query, err := rcquery.Parse("?b=2&a=1&a=%24x&ids=1,2&empty&%C3%BC=%C3%BC")
+	should.BeNil(t, err)
+	should.BeTrue(t, query.Has("a"))
+	should.BeTrue(t, query.Has("empty"))
+	should.BeTrue(t, query.Has("ü"))
+	should.BeEqual(t, query.Add("c", 3).Get(), "?b=2&a=1&a=%24x&ids=1,2&empty&%C3%BC=%C3%BC&c=3")
+
+	query, err = rcquery.Parse("")
+	should.BeNil(t, err)
+	should.BeEqual(t, query.Get(), "")
+
+	_, err = rcquery.Parse("a=%zz")
+	should.NotBeNil(t, err)
+
+	_, err = rcquery.Parse("a%zz=1")
+	should.NotBeNil(t, err)
+	should.BeTrue(t, strings.Contains(err.Error(), `"a%zz"`), err)
+}
+
+func TestMergeQuery(t *testing.T) {
+	query := rcquery.New().Add("limit", 10)
+
+	merged, err := query.Merge("http://localhost/user?x=1#top")
+	should.BeNil(t, err)
+	should.BeEqual(t, merged, "http://localhost/user?x=1&limit=10#top")
+
+	merged, err = query.Merge("http://localhost/user")
+	should.BeNil(t, err)
+	should.BeEqual(t, merged, "http://localhost/user?limit=10")
+
+	merged, err = query.Merge("http://localhost/user?")
+	should.BeNil(t, err)
+	should.BeEqual(t, merged, "http://localhost/user?limit=10")
+
+	merged, err = query.Merge("http://localhost/user?uploads&a%5B%5D=1")
+	should.BeNil(t, err)
+	should.BeEqual(t, merged, "http://localhost/user?uploads&a%5B%5D=1&limit=10")
+
+	merged, err = rcquery.New().Merge("http://localhost/user?uploads&a%5B%5D=1#top")
+	should.BeNil(t, err)
+	should.BeEqual(t, merged, "http://localhost/user?uploads&a%5B%5D=1#top")
+
+	merged, err = rcquery.New().Merge("http://localhost/user?")
+	should.BeNil(t, err)
+	should.BeEqual(t, merged, "http://localhost/user?")
+
+	_, err = query.Merge("http://localhost/user?a=%zz")
+	should.NotBeNil(t, err)
+}
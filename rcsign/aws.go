@@ -0,0 +1,118 @@
+package rcsign
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	awsAlgorithm      = "AWS4-HMAC-SHA256"
+	awsDateFormat     = "20060102T150405Z"
+	awsDateHeader     = "X-Amz-Date"
+	awsTokenHeader    = "X-Amz-Security-Token"
+	awsUnsignedBody   = "UNSIGNED-PAYLOAD"
+	awsContentSHA256  = "X-Amz-Content-Sha256"
+	awsScopeTerminate = "aws4_request"
+)
+
+// awsIgnoredHeaders are not signed, because they are changed on the way.
+var awsIgnoredHeaders = map[string]bool{
+	"authorization":   true,
+	"user-agent":      true,
+	"x-amzn-trace-id": true,
+	"expect":          true,
+}
+
+// AWSV4Signer signs requests with AWS Signature Version 4.
+type AWSV4Signer struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken of temporary credentials, optional.
+	SessionToken string
+	Region       string
+	Service      string
+	// UnsignedPayload skips the hash of the body, e.g. for streamed bodies.
+	UnsignedPayload bool
+	// DisableURIPathEscaping doesn't escape the path twice,
+	// the path of the service s3 is always escaped once.
+	DisableURIPathEscaping bool
+	// Now returns the signing time, default is time.Now.
+	Now func() time.Time
+}
+
+func (s *AWSV4Signer) Sign(request *http.Request) error {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	date := now().UTC()
+
+	request.Header.Set(awsDateHeader, date.Format(awsDateFormat))
+	if s.SessionToken != "" {
+		request.Header.Set(awsTokenHeader, s.SessionToken)
+	}
+
+	bodyHash := awsUnsignedBody
+	if !s.UnsignedPayload {
+		var err error
+		bodyHash, err = payloadHash(request)
+		if err != nil {
+			return err
+		}
+	}
+	if s.Service == "s3" {
+		request.Header.Set(awsContentSHA256, bodyHash)
+	}
+
+	canonical, signedHeaders := s.canonicalRequest(request, bodyHash)
+	scope := strings.Join([]string{date.Format("20060102"), s.Region, s.Service, awsScopeTerminate}, "/")
+	stringToSign := strings.Join([]string{
+		awsAlgorithm,
+		date.Format(awsDateFormat),
+		scope,
+		hashHex(canonical),
+	}, "\n")
+
+	key := hmacSum(sha256.New, []byte("AWS4"+s.SecretAccessKey), date.Format("20060102"))
+	key = hmacSum(sha256.New, key, s.Region)
+	key = hmacSum(sha256.New, key, s.Service)
+	key = hmacSum(sha256.New, key, awsScopeTerminate)
+	signature := hex.EncodeToString(hmacSum(sha256.New, key, stringToSign))
+
+	request.Header.Set("Authorization", awsAlgorithm+
+		" Credential="+s.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+	return nil
+}
+
+func (s *AWSV4Signer) canonicalRequest(request *http.Request, bodyHash string) (canonical string, signedHeaders string) {
+	names := []string{"host"}
+	for name := range request.Header {
+		if !awsIgnoredHeaders[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	signedHeaders, headers := canonicalHeaders(request, names)
+
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if !s.DisableURIPathEscaping && s.Service != "s3" {
+		path = uriEncode(path, false)
+	}
+
+	canonical = strings.Join([]string{
+		request.Method,
+		path,
+		canonicalQuery(request.URL),
+		headers,
+		signedHeaders,
+		bodyHash,
+	}, "\n")
+	return canonical, signedHeaders
+}
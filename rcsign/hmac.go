@@ -0,0 +1,77 @@
+package rcsign
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const dateHeader = "X-Date"
+
+// HMACSigner signs the canonical request with a shared secret:
+//
+//	METHOD
+//	escaped path
+//	sorted query
+//	signed headers (name:value, one per line, incl. host and x-date)
+//	signed header names (separated by ;)
+//	hex(sha256(body))
+//
+// The signature is sent as
+//
+//	Authorization: HMAC-SHA256 KeyId=<id>, SignedHeaders=<names>, Signature=<hex>
+type HMACSigner struct {
+	KeyID  string
+	Secret []byte
+	// SignedHeaders are signed additionally to host and x-date.
+	SignedHeaders []string
+	// Header is the header of the signature, default is Authorization.
+	Header string
+	// Now returns the signing time, default is time.Now.
+	Now func() time.Time
+}
+
+func (s *HMACSigner) Sign(request *http.Request) error {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	request.Header.Set(dateHeader, now().UTC().Format(time.RFC3339))
+
+	canonical, signedHeaders, err := s.CanonicalRequest(request)
+	if err != nil {
+		return err
+	}
+
+	signature := hex.EncodeToString(hmacSum(sha256.New, s.Secret, canonical))
+
+	header := s.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	request.Header.Set(header, "HMAC-SHA256 KeyId="+s.KeyID+", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+// CanonicalRequest returns the signed string of the request and the signed header names.
+func (s *HMACSigner) CanonicalRequest(request *http.Request) (canonical string, signedHeaders string, err error) {
+	bodyHash, err := payloadHash(request)
+	if err != nil {
+		return "", "", err
+	}
+
+	names := append([]string{"host", dateHeader}, s.SignedHeaders...)
+	signedHeaders, headers := canonicalHeaders(request, names)
+
+	canonical = strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		canonicalQuery(request.URL),
+		headers,
+		signedHeaders,
+		bodyHash,
+	}, "\n")
+	return canonical, signedHeaders, nil
+}
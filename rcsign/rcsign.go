@@ -0,0 +1,126 @@
+// Package rcsign contains signers for restclient.RestClient.AddSigner.
+package rcsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ErrBodyNotReplayable is returned if the body of the request can't be read
+// for the signature without consuming it.
+var ErrBodyNotReplayable = errors.New("rcsign: request body can't be read for the signature")
+
+// payloadHash returns the hex encoded sha256 hash of the request body.
+func payloadHash(request *http.Request) (string, error) {
+	h := sha256.New()
+	if request.Body != nil && request.Body != http.NoBody {
+		if request.GetBody == nil {
+			return "", ErrBodyNotReplayable
+		}
+
+		body, err := request.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+
+		_, err = io.Copy(h, body)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// canonicalQuery returns the query sorted by key and value, encoded with uriEncode.
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// canonicalHeaders returns the signed headers (lower case, sorted) and their canonical form.
+func canonicalHeaders(request *http.Request, names []string) (signedHeaders string, headers string) {
+	seen := make(map[string]bool)
+	lower := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			lower = append(lower, name)
+		}
+	}
+	sort.Strings(lower)
+
+	var canonical strings.Builder
+	for _, name := range lower {
+		var values []string
+		if name == "host" {
+			values = []string{host(request)}
+		} else {
+			values = request.Header.Values(name)
+		}
+
+		trimmed := make([]string, 0, len(values))
+		for _, value := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(value), " "))
+		}
+		canonical.WriteString(name + ":" + strings.Join(trimmed, ",") + "\n")
+	}
+	return strings.Join(lower, ";"), canonical.String()
+}
+
+func host(request *http.Request) string {
+	if request.Host != "" {
+		return request.Host
+	}
+	return request.URL.Host
+}
+
+// uriEncode encodes everything except the unreserved characters of RFC 3986,
+// the slash is kept if encodeSlash is false.
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			encoded.WriteByte(c)
+			continue
+		}
+		encoded.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return encoded.String()
+}
+
+func hmacSum(newHash func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
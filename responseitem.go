@@ -1,12 +1,11 @@
 package restclient
 
 import (
-	"encoding/json"
-	"encoding/xml"
 	"net/http"
 )
 
 type ResponseItem struct {
+	method string
 	header http.Header
 	body   []byte
 	Result Result
@@ -27,8 +26,8 @@ func (r *ResponseItem) XML(output interface{}) {
 	}
 
 	// set the output if there is something
-	if r.Result.StatusCode == http.StatusOK {
-		r.Result.Err = xml.Unmarshal(r.body, output)
+	if r.isSuccess() && r.hasBody() {
+		r.Result.Err = unmarshal(xmlMediaType, r.body, output)
 	}
 
 	return
@@ -40,26 +39,102 @@ func (r *ResponseItem) Json(output interface{}) {
 	}
 
 	// set the output if there is something
-	if r.Result.StatusCode == http.StatusOK {
-		r.Result.Err = json.Unmarshal(r.body, output)
+	if r.isSuccess() && r.hasBody() {
+		r.Result.Err = unmarshal(jsonMediaType, r.body, output)
 	}
 
 	return
 }
 
+// Decode decodes the body with the codec of the response content type,
+// see RegisterCodec.
+func (r *ResponseItem) Decode(output interface{}) {
+	if r.Result.Err != nil {
+		return
+	}
+
+	// set the output if there is something
+	if r.isSuccess() && r.hasBody() {
+		r.Result.Err = unmarshal(normalizeMediaType(r.header.Get(contentType)), r.body, output)
+	}
+}
+
 func (r *ResponseItem) Body() []byte {
 	if r.Result.Err != nil {
 		return nil
 	}
 
 	// get the output if there is something
-	if r.Result.StatusCode == http.StatusOK {
+	if r.isSuccess() {
 		return r.body
 	}
 
 	return nil
 }
 
+// ErrorXML decodes the xml body of a failed response (status >= 400),
+// if no status codes are given every failed status code is decoded.
+// Bodies that are not decodable are only available as Result.ResponseError.
+func (r *ResponseItem) ErrorXML(output interface{}, statusCodes ...int) {
+	if r.Result.Err != nil {
+		return
+	}
+
+	if r.isError(statusCodes) {
+		r.decodeError(xmlMediaType, output)
+	}
+}
+
+// ErrorJson decodes the json body of a failed response (status >= 400),
+// if no status codes are given every failed status code is decoded.
+// Bodies that are not decodable are only available as Result.ResponseError.
+func (r *ResponseItem) ErrorJson(output interface{}, statusCodes ...int) {
+	if r.Result.Err != nil {
+		return
+	}
+
+	if r.isError(statusCodes) {
+		r.decodeError(jsonMediaType, output)
+	}
+}
+
+func (r *ResponseItem) isSuccess() bool {
+	return r.Result.StatusCode >= 200 && r.Result.StatusCode < 300
+}
+
+// isFailed reports if the response failed (status >= 400).
+func (r *ResponseItem) isFailed() bool {
+	return r.Result.StatusCode >= http.StatusBadRequest
+}
+
+func (r *ResponseItem) isError(statusCodes []int) bool {
+	if !r.isFailed() {
+		return false
+	}
+	if len(statusCodes) == 0 {
+		return true
+	}
+	for _, code := range statusCodes {
+		if r.Result.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeError decodes the body of a failed response and reports if it was decodable.
+func (r *ResponseItem) decodeError(mediaType string, output interface{}) bool {
+	if !r.isFailed() || !r.hasBody() {
+		return false
+	}
+	return unmarshal(mediaType, r.body, output) == nil
+}
+
+// hasBody reports if the response contains a body, responses of HEAD requests never do.
+func (r *ResponseItem) hasBody() bool {
+	return r.method != http.MethodHead && len(r.body) > 0
+}
+
 func (r *ResponseItem) Header(key string) (values []string, ok bool) {
 	if r.Result.Err != nil {
 		return
@@ -2,15 +2,15 @@ package restclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"encoding/xml"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
-	"strings"
+	"reflect"
 	"time"
 
 	"github.com/maprost/restclient/rcdep"
@@ -19,6 +19,7 @@ import (
 
 const (
 	contentType         = "Content-Type"
+	accept              = "Accept"
 	jsonContentType     = "application/json; charset=utf-8"
 	xmlContentType      = "application/xml; charset=utf-8"
 	formDataContentType = "application/x-www-form-urlencoded"
@@ -31,16 +32,30 @@ type noLogger struct{}
 func (nl noLogger) Printf(format string, v ...interface{}) {}
 
 type RestClient struct {
-	log           rcdep.Logger
-	requestPath   string
-	requestMethod string
-	requestBody   io.Reader
-	header        map[string][]string
-	query         rcquery.Query
-	err           error
-	httpClient    *http.Client
-	basicAuthUser string
-	basicAuthPW   string
+	client         *Client
+	ctx            context.Context
+	log            rcdep.Logger
+	requestPath    string
+	pathTemplate   string
+	pathParams     map[string]string
+	requestMethod  string
+	requestBody    []byte
+	multipart      *multipartBody
+	compression    string
+	header         map[string][]string
+	query          rcquery.Query
+	err            error
+	httpClient     *http.Client
+	basicAuthUser  string
+	basicAuthPW    string
+	retryPolicy    *RetryPolicy
+	errorOutput    interface{}
+	errorMediaType string
+	middlewares    []Middleware
+	tokenSource    TokenSource
+	secrets        []string
+	signer         Signer
+	logConfig      *LogConfig
 }
 
 func Get(path string) *RestClient {
@@ -67,11 +82,37 @@ func Delete(path string) *RestClient {
 	return rc
 }
 
+func Patch(path string) *RestClient {
+	rc := newRC(path)
+	rc.requestMethod = http.MethodPatch
+	return rc
+}
+
+func Head(path string) *RestClient {
+	rc := newRC(path)
+	rc.requestMethod = http.MethodHead
+	return rc
+}
+
+func Options(path string) *RestClient {
+	rc := newRC(path)
+	rc.requestMethod = http.MethodOptions
+	return rc
+}
+
+// Method creates a request with an arbitrary http method.
+func Method(method string, path string) *RestClient {
+	rc := newRC(path)
+	rc.requestMethod = method
+	return rc
+}
+
 func newRC(path string) *RestClient {
 	return &RestClient{
-		log:         noLogger{},
-		requestPath: path,
-		header:      make(map[string][]string),
+		log:          noLogger{},
+		requestPath:  path,
+		pathTemplate: path,
+		header:       make(map[string][]string),
 	}
 }
 
@@ -85,17 +126,87 @@ func (r *RestClient) AddHttpClient(httpClient *http.Client) *RestClient {
 	return r
 }
 
+// WithContext sets the context of the request. A canceled or expired context
+// aborts the request and Result.Err matches context.Canceled or
+// context.DeadlineExceeded (and ErrTimeout) via errors.Is.
+func (r *RestClient) WithContext(ctx context.Context) *RestClient {
+	r.ctx = ctx
+	return r
+}
+
 func (r *RestClient) NoLogger() *RestClient {
 	r.log = noLogger{}
 	return r
 }
 
 func (r *RestClient) AddQueryParam(key string, value interface{}) *RestClient {
-	r.query.Add(key, value)
+	// check for error
+	if r.err != nil {
+		return r
+	}
+
+	r.err = r.query.Add(key, value).Err()
+	return r
+}
+
+// AddQueryArrayParam adds a slice as query param encoded with the given format.
+func (r *RestClient) AddQueryArrayParam(key string, value interface{}, format rcquery.ArrayFormat) *RestClient {
+	// check for error
+	if r.err != nil {
+		return r
+	}
+
+	r.err = r.query.AddArray(key, value, format).Err()
+	return r
+}
+
+// AddQueryParams adds all fields of a struct or all entries of a map
+// (e.g. url.Values) as query params, see rcquery.Query.AddStruct for
+// the supported tags.
+func (r *RestClient) AddQueryParams(params interface{}) *RestClient {
+	// check for error
+	if r.err != nil {
+		return r
+	}
+
+	if reflect.Indirect(reflect.ValueOf(params)).Kind() == reflect.Map {
+		r.err = r.query.AddMap(params).Err()
+	} else {
+		r.err = r.query.AddStruct(params).Err()
+	}
+	return r
+}
+
+// SetQueryKeyStyle sets the style of nested query keys of structs and maps,
+// default is rcquery.DotKeys.
+func (r *RestClient) SetQueryKeyStyle(style rcquery.KeyStyle) *RestClient {
+	r.query.SetKeyStyle(style)
+	return r
+}
+
+// SetQueryArrayFormat sets the default format of slices and arrays in query params,
+// default is rcquery.RepeatArray.
+func (r *RestClient) SetQueryArrayFormat(format rcquery.ArrayFormat) *RestClient {
+	r.query.SetArrayFormat(format)
+	return r
+}
+
+// SetQueryTimeLayout sets the layout of time.Time values in query params,
+// default is time.RFC3339.
+func (r *RestClient) SetQueryTimeLayout(layout string) *RestClient {
+	r.query.SetTimeLayout(layout)
+	return r
+}
+
+// RegisterQueryEncoder registers an encoder of query params for the type of sample
+// for this request, see rcquery.Query.RegisterEncoder.
+func (r *RestClient) RegisterQueryEncoder(sample interface{}, encoder rcquery.EncoderFunc) *RestClient {
+	r.query.RegisterEncoder(sample, encoder)
 	return r
 }
 
 func (r *RestClient) AddHeader(key string, value string) *RestClient {
+	key = http.CanonicalHeaderKey(key)
 	if _, ok := r.header[key]; ok {
 		// update
 		r.header[key] = append(r.header[key], value)
@@ -112,41 +223,79 @@ func (r *RestClient) AddBasicAuth(user string, pw string) *RestClient {
 	return r
 }
 
-// AddJsonBody adds a struct as json to the request body.
-// Only usable in Post/Put requests.
-func (r *RestClient) AddJsonBody(input interface{}) *RestClient {
-	// check for error
-	if r.err != nil {
-		return r
-	}
-
-	js := new(bytes.Buffer)
-	r.err = json.NewEncoder(js).Encode(input)
+// AddRetryPolicy sets the retry policy of the request,
+// the request body is replayed for every attempt.
+func (r *RestClient) AddRetryPolicy(policy RetryPolicy) *RestClient {
+	r.retryPolicy = &policy
+	return r
+}
 
-	if r.err == nil {
-		r.requestBody = js
-		r.AddHeader(contentType, jsonContentType)
+// accept sets the Accept header, if it's not set by the request or client.
+func (r *RestClient) accept(mediaTypes string) {
+	if _, ok := r.header[accept]; ok {
+		return
+	}
+	if r.client != nil {
+		if _, ok := r.client.header[accept]; ok {
+			return
+		}
 	}
+	r.AddHeader(accept, mediaTypes)
+}
 
+// OnErrorJson decodes the json body of a failed response (status >= 400)
+// into errorOutput, it's available as Result.ErrorBody afterwards.
+// Bodies that are not decodable are only available as Result.ResponseError.
+func (r *RestClient) OnErrorJson(errorOutput interface{}) *RestClient {
+	r.errorOutput = errorOutput
+	r.errorMediaType = jsonMediaType
 	return r
 }
 
+// OnErrorXML decodes the xml body of a failed response (status >= 400)
+// into errorOutput, it's available as Result.ErrorBody afterwards.
+// Bodies that are not decodable are only available as Result.ResponseError.
+func (r *RestClient) OnErrorXML(errorOutput interface{}) *RestClient {
+	r.errorOutput = errorOutput
+	r.errorMediaType = xmlMediaType
+	return r
+}
+
+// AddJsonBody adds a struct as json to the request body.
+// Only usable in Post/Put/Patch requests.
+func (r *RestClient) AddJsonBody(input interface{}) *RestClient {
+	return r.AddEncodedBody(input, jsonMediaType)
+}
+
 // AddXMLBody adds a struct as xml to the request body.
-// Only usable in Post/Put requests.
+// Only usable in Post/Put/Patch requests.
 func (r *RestClient) AddXMLBody(input interface{}) *RestClient {
+	return r.AddEncodedBody(input, xmlMediaType)
+}
+
+// AddEncodedBody adds a struct encoded with the codec of the media type
+// to the request body, see RegisterCodec.
+// Only usable in Post/Put/Patch requests.
+func (r *RestClient) AddEncodedBody(input interface{}, mediaType string) *RestClient {
 	// check for error
 	if r.err != nil {
 		return r
 	}
 
-	x := new(bytes.Buffer)
-	r.err = xml.NewEncoder(x).Encode(input)
+	codec, ok := CodecFor(mediaType)
+	if !ok {
+		r.err = &MediaTypeError{MediaType: mediaType}
+		return r
+	}
 
-	if r.err == nil {
-		r.requestBody = x
-		r.AddHeader(contentType, xmlContentType)
+	body, err := codec.Marshal(input)
+	if err != nil {
+		r.err = err
+		return r
 	}
 
+	r.requestBody = body
+	r.AddHeader(contentType, codec.ContentType())
 	return r
 }
 
@@ -158,20 +307,20 @@ func (r *RestClient) AddFormDataBody(data url.Values) *RestClient {
 		return r
 	}
 
-	r.requestBody = strings.NewReader(data.Encode())
+	r.requestBody = []byte(data.Encode())
 	r.AddHeader(contentType, formDataContentType)
 	return r
 }
 
 // AddBody adds a []byte to the request body.
-// Only usable in Post/Put requests.
+// Only usable in Post/Put/Patch requests.
 func (r *RestClient) AddBody(input []byte, contentTypeValue string) *RestClient {
 	// check for error
 	if r.err != nil {
 		return r
 	}
 
-	r.requestBody = bytes.NewReader(input)
+	r.requestBody = input
 	r.AddHeader(contentType, contentTypeValue)
 	return r
 }
@@ -196,6 +345,7 @@ func (r *RestClient) SendAndGetResponse() (output string, result Result) {
 }
 
 func (r *RestClient) SendAndGetJsonResponse(output interface{}) (result Result) {
+	r.accept(jsonMediaType)
 	responseItem := r.send()
 
 	responseItem.Json(output)
@@ -204,6 +354,7 @@ func (r *RestClient) SendAndGetJsonResponse(output interface{}) (result Result)
 }
 
 func (r *RestClient) SendAndGetXMLResponse(output interface{}) (result Result) {
+	r.accept(xmlMediaType)
 	responseItem := r.send()
 
 	responseItem.XML(output)
@@ -211,68 +362,322 @@ func (r *RestClient) SendAndGetXMLResponse(output interface{}) (result Result) {
 	return
 }
 
+// SendAndDecode accepts all media types with a registered codec and decodes
+// the response with the codec of the response content type. An unexpected
+// content type is reported as *MediaTypeError in Result.Err.
+func (r *RestClient) SendAndDecode(output interface{}) (result Result) {
+	r.accept(acceptedMediaTypes())
+	responseItem := r.send()
+
+	responseItem.Decode(output)
+	result = responseItem.Result
+	return
+}
+
+// SendAndStream returns the response body without buffering it, the caller
+// has to close it. The body of a failed response (status >= 400) is read
+// into the Result like in Send and no body is returned.
+func (r *RestClient) SendAndStream() (body io.ReadCloser, result Result) {
+	var responseItem ResponseItem
+	ctx := r.context()
+
+	response, err := r.open(ctx, &responseItem)
+	if err != nil {
+		responseItem.Result.Err = requestError(ctx, err)
+		return nil, responseItem.Result
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		defer response.Body.Close()
+		err = r.receive(response, &responseItem)
+		if err != nil {
+			responseItem.Result.Err = requestError(ctx, err)
+		}
+		return nil, responseItem.Result
+	}
+
+	return response.Body, responseItem.Result
+}
+
+// SendAndWriteTo copies the response body into w without buffering it.
+// The body of a failed response (status >= 400) is read into the Result
+// like in Send and not written into w.
+func (r *RestClient) SendAndWriteTo(w io.Writer) (written int64, result Result) {
+	body, result := r.SendAndStream()
+	if body == nil {
+		return 0, result
+	}
+	defer body.Close()
+
+	written, err := io.Copy(w, body)
+	if err != nil {
+		result.Err = requestError(r.context(), err)
+	}
+	return written, result
+}
+
+func (r *RestClient) SendContext(ctx context.Context) Result {
+	return r.WithContext(ctx).Send()
+}
+
+func (r *RestClient) SendAndGetResponseItemContext(ctx context.Context) ResponseItem {
+	return r.WithContext(ctx).SendAndGetResponseItem()
+}
+
+func (r *RestClient) SendAndGetResponseContext(ctx context.Context) (output string, result Result) {
+	return r.WithContext(ctx).SendAndGetResponse()
+}
+
+func (r *RestClient) SendAndGetJsonResponseContext(ctx context.Context, output interface{}) Result {
+	return r.WithContext(ctx).SendAndGetJsonResponse(output)
+}
+
+func (r *RestClient) SendAndDecodeContext(ctx context.Context, output interface{}) Result {
+	return r.WithContext(ctx).SendAndDecode(output)
+}
+
+func (r *RestClient) SendAndGetXMLResponseContext(ctx context.Context, output interface{}) Result {
+	return r.WithContext(ctx).SendAndGetXMLResponse(output)
+}
+
 func (r *RestClient) send() (responseItem ResponseItem) {
-	if r.err != nil {
-		responseItem.Result.Err = r.err
+	ctx := r.context()
+	response, err := r.open(ctx, &responseItem)
+	if err != nil {
+		responseItem.Result.Err = requestError(ctx, err)
 		return
 	}
+	defer response.Body.Close()
 
-	// create request
-	url := r.requestPath + r.query.Get()
-	request, err := http.NewRequest(r.requestMethod, url, r.requestBody)
+	err = r.receive(response, &responseItem)
 	if err != nil {
-		responseItem.Result.Err = err
-		return
+		responseItem.Result.Err = requestError(ctx, err)
 	}
+	return
+}
 
-	// add header
-	for key, values := range r.header {
-		for _, value := range values {
-			request.Header.Add(key, value)
+// open sends the request and sets the meta data of the response,
+// the body of the returned response must be closed by the caller.
+func (r *RestClient) open(ctx context.Context, responseItem *ResponseItem) (*http.Response, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// add default query params of the client
+	query := r.query.Clone()
+	if r.client != nil {
+		for _, param := range r.client.query {
+			if !r.query.Has(param.key) {
+				query.Add(param.key, param.value)
+			}
 		}
 	}
+	if err := query.Err(); err != nil {
+		return nil, err
+	}
 
-	if r.basicAuthUser != "" {
-		request.SetBasicAuth(r.basicAuthUser, r.basicAuthPW)
+	// fill path params and add query params to the query of the path
+	path, err := fillPath(r.requestPath, r.pathParams)
+	if err != nil {
+		return nil, err
+	}
+	url, err := query.Merge(path)
+	if err != nil {
+		return nil, err
 	}
 
-	// send request
-	if r.httpClient == nil {
-		r.httpClient = http.DefaultClient
+	body := r.requestBody
+	if r.compression != "" && body != nil {
+		body, err = compress(body, r.compression)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.requestBody != nil && r.config().LogRequestBody {
+		r.logf(LogFull, "request Body: %v", r.logBody(r.requestBody))
 	}
-	start := time.Now()
-	response, err := r.httpClient.Do(request)
-	duration := time.Now().Sub(start)
-	r.log.Printf("request [time: %v] %s:%s", duration, r.requestMethod, url)
-	//r.log.Printf("request headers %v", request.Header)
+
+	// send request
+	response, err := r.do(ctx, url, body, &responseItem.Result)
 	if err != nil {
-		responseItem.Result.Err = err
-		return
+		return nil, err
 	}
-	defer response.Body.Close()
+	decompress(response)
 
 	// show header
-	r.log.Printf("response Url: %s", response.Request.URL.String())
-	r.log.Printf("response Status: %v", response.Status)
-	r.log.Printf("response Headers: %v", response.Header)
+	r.logf(LogSummary, "response Url: %s", r.logURL(response.Request.URL.String()))
+	r.logf(LogSummary, "response Status: %v", response.Status)
+	r.logf(LogHeaders, "response Headers: %v", r.logHeader(response.Header))
 	responseItem.header = response.Header
+	responseItem.method = r.requestMethod
+
+	// set link + status
+	responseItem.Result.Link = response.Request.URL.String()
+	responseItem.Result.StatusCode = response.StatusCode
+	responseItem.Result.Method = r.requestMethod
+	responseItem.Result.PathTemplate = r.pathTemplate
+	responseItem.Result.Header = response.Header
+
+	return response, nil
+}
 
+// receive reads the body of the response.
+func (r *RestClient) receive(response *http.Response, responseItem *ResponseItem) (err error) {
 	// get body
 	responseItem.body, err = ioutil.ReadAll(response.Body)
 	if err != nil {
-		responseItem.Result.Err = err
-		return
+		return err
 	}
-	r.log.Printf("response Body: %v", string(responseItem.body))
-
-	// set link + status
-	responseItem.Result.Link = response.Request.URL.String()
-	responseItem.Result.StatusCode = response.StatusCode
+	r.logf(LogFull, "response Body: %v", r.logBody(responseItem.body))
 
 	// set responseError of failed response (status >= 400)
-	if responseItem.Result.StatusCode >= http.StatusBadRequest {
+	if responseItem.isFailed() {
 		responseItem.Result.ResponseError = string(responseItem.body)
+
+		if isProblem(response.Header) && responseItem.hasBody() {
+			var problem Problem
+			if json.Unmarshal(responseItem.body, &problem) == nil {
+				if problem.Status == 0 {
+					problem.Status = responseItem.Result.StatusCode
+				}
+				responseItem.Result.Problem = &problem
+			}
+		}
+
+		if r.errorOutput != nil && responseItem.decodeError(r.errorMediaType, r.errorOutput) {
+			responseItem.Result.ErrorBody = r.errorOutput
+		}
 	}
 
-	return
+	return nil
+}
+
+func (r *RestClient) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// do sends the request and retries it as long as the retry policy allows it.
+// The body of the returned response must be closed by the caller.
+func (r *RestClient) do(ctx context.Context, url string, body []byte, result *Result) (*http.Response, error) {
+	if r.httpClient == nil {
+		r.httpClient = http.DefaultClient
+	}
+
+	roundTrip := r.roundTrip()
+
+	policy := r.retryPolicy
+	if policy == nil || (r.multipart != nil && !r.multipart.replayable()) {
+		policy = &RetryPolicy{MaxAttempts: 1}
+	}
+
+	for attempt := 1; ; attempt++ {
+		request, err := r.newRequest(ctx, url, body)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		response, err := roundTrip(request)
+		duration := time.Now().Sub(start)
+		if err == nil && response == nil {
+			err = errMissingResponse
+		}
+		if err != nil && request.Body != nil {
+			// a middleware may abort without sending, the body must be
+			// closed to stop the writer of a streamed body
+			request.Body.Close()
+		}
+		r.logf(LogSummary, "request [time: %v] %s:%s", duration, r.requestMethod, r.logURL(url))
+		r.logf(LogHeaders, "request Headers: %v", r.logHeader(request.Header))
+		result.Attempts = attempt
+
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.retry(response, err) {
+			if transportErr, ok := err.(*transportError); ok {
+				err = transportErr.err
+			}
+			return response, err
+		}
+
+		wait := policy.backoff(attempt, response)
+		if err != nil {
+			r.logf(LogSummary, "request attempt %d/%d failed: %v, retry in %v", attempt, policy.MaxAttempts, err, wait)
+		} else {
+			r.logf(LogSummary, "request attempt %d/%d failed: %v, retry in %v", attempt, policy.MaxAttempts, response.Status, wait)
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// openMultipart opens the multipart body, compressed if needed.
+func (r *RestClient) openMultipart() (io.ReadCloser, string) {
+	body, multipartContentType := r.multipart.open()
+	if r.compression != "" {
+		body = compressStream(body, r.compression)
+	}
+	return body, multipartContentType
+}
+
+// newRequest creates the http request, it's called for every attempt
+// so the body can be replayed.
+func (r *RestClient) newRequest(ctx context.Context, url string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	var multipartContentType string
+	if r.multipart != nil {
+		reader, multipartContentType = r.openMultipart()
+	} else if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, r.requestMethod, url, reader)
+	if err != nil {
+		if closer, ok := reader.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, err
+	}
+	if r.multipart != nil && r.multipart.replayable() {
+		request.GetBody = func() (io.ReadCloser, error) {
+			body, _ := r.openMultipart()
+			return body, nil
+		}
+	}
+
+	// add header, the request header overrides the default header of the client
+	if r.client != nil {
+		for key, values := range r.client.header {
+			for _, value := range values {
+				request.Header.Add(key, value)
+			}
+		}
+	}
+	for key, values := range r.header {
+		request.Header.Del(key)
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+
+	if multipartContentType != "" {
+		request.Header.Set(contentType, multipartContentType)
+	}
+	if r.compression != "" && (body != nil || r.multipart != nil) {
+		request.Header.Set(contentEncoding, r.compression)
+	}
+
+	if r.basicAuthUser != "" {
+		request.SetBasicAuth(r.basicAuthUser, r.basicAuthPW)
+	}
+
+	return request, nil
 }
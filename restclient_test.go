@@ -1,15 +1,31 @@
 package restclient_test
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/maprost/restclient"
+	"github.com/maprost/restclient/rcquery"
+	"github.com/maprost/restclient/rcsign"
 	"github.com/maprost/restclient/rctest"
 	"github.com/maprost/should"
 )
@@ -281,3 +297,1461 @@ func TestGetResponseItem_ok(t *testing.T) {
 	should.BeTrue(t, ok)
 	should.BeEqual(t, ct, []string{"maybe an integer"})
 }
+
+func TestContextDeadline_fail(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	result := restclient.Get(url).SendContext(ctx)
+	should.BeTrue(t, errors.Is(result.Err, context.DeadlineExceeded))
+	should.BeTrue(t, errors.Is(result.Err, restclient.ErrTimeout))
+	should.BeEqual(t, result.StatusCode, 0)
+}
+
+func TestContextCanceled_fail(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out struct{}
+	result := restclient.Get(url).WithContext(ctx).SendAndGetJsonResponse(&out)
+	should.BeTrue(t, errors.Is(result.Err, context.Canceled))
+	should.BeFalse(t, errors.Is(result.Err, restclient.ErrTimeout))
+}
+
+func TestContext_ok(t *testing.T) {
+	type Result struct {
+		Msg string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(Result{Msg: "Blob"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var r Result
+	result := restclient.Get(url).SendAndGetJsonResponseContext(ctx, &r)
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, r, Result{Msg: "Blob"})
+}
+
+func TestClientDefaults_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		user, pw, _ := r.BasicAuth()
+		if user != "user" || pw != "pw" {
+			http.Error(w, "Wrong auth", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Accept-Language") != "da" || r.URL.Query().Get("limit") != "14" {
+			http.Error(w, "Wrong defaults", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	client := restclient.New(strings.TrimSuffix(url, "/test")).
+		AddHeader("Accept-Language", "da").
+		AddQueryParam("limit", 14).
+		AddBasicAuth("user", "pw")
+
+	result := client.Get("/test").Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestClientOverride_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Language") != "en" || r.URL.Query().Get("limit") != "2" {
+			http.Error(w, "Defaults not overridden", http.StatusBadRequest)
+			return
+		}
+		if len(r.Header["Accept-Language"]) != 1 || len(r.URL.Query()["limit"]) != 1 {
+			http.Error(w, "Defaults still set", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	client := restclient.New(strings.TrimSuffix(url, "test")).
+		AddHeader("Accept-Language", "da").
+		AddQueryParam("limit", 14)
+
+	result := client.Put("test").
+		AddHeader("accept-language", "en").
+		AddQueryParam("limit", 2).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestRetryPolicy_ok(t *testing.T) {
+	type Body struct {
+		Msg string
+	}
+
+	calls := 0
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		calls++
+
+		var body Body
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil || body.Msg != "Blob" {
+			http.Error(w, "Body not replayed", http.StatusBadRequest)
+			return
+		}
+
+		if calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "Try again", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	policy := restclient.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+
+	result := restclient.Post(url).AddJsonBody(Body{Msg: "Blob"}).AddRetryPolicy(policy).Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+	should.BeEqual(t, result.Attempts, 3)
+	should.BeEqual(t, calls, 3)
+}
+
+func TestRetryPolicyExhausted_fail(t *testing.T) {
+	calls := 0
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "Too many", http.StatusTooManyRequests)
+	})
+
+	policy := restclient.DefaultRetryPolicy()
+	policy.MaxAttempts = 2
+	policy.InitialBackoff = time.Millisecond
+
+	result := restclient.New(url).AddRetryPolicy(policy).Get("").Send()
+	rctest.CheckResult(t, result, rctest.FailedResponse(429, "Too many\n"))
+	should.BeEqual(t, result.Attempts, 2)
+	should.BeEqual(t, calls, 2)
+}
+
+func TestRetryPolicyNotRetried_ok(t *testing.T) {
+	calls := 0
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "Broken", http.StatusInternalServerError)
+	})
+
+	result := restclient.Get(url).AddRetryPolicy(restclient.DefaultRetryPolicy()).Send()
+	rctest.CheckResult(t, result, rctest.FailedResponse(500, "Broken\n"))
+	should.BeEqual(t, result.Attempts, 1)
+	should.BeEqual(t, calls, 1)
+}
+
+func TestSendBodyWithJsonPatchRestClient_ok(t *testing.T) {
+	type Body struct {
+		Msg string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		if r.Method != http.MethodPatch {
+			http.Error(w, "No patch method", http.StatusBadRequest)
+			return
+		}
+
+		var body Body
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil || body.Msg != "Blob" {
+			http.Error(w, "Body not readable", http.StatusBadRequest)
+			return
+		}
+
+		body.Msg = "Crop"
+		js, _ := json.Marshal(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	})
+
+	var res Body
+	result := restclient.Patch(url).AddJsonBody(Body{Msg: "Blob"}).SendAndGetJsonResponse(&res)
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, res.Msg, "Crop")
+}
+
+func TestSendBodyWithXMLPatchRestClient_ok(t *testing.T) {
+	type Body struct {
+		Msg string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var body Body
+		err := xml.NewDecoder(r.Body).Decode(&body)
+		if err != nil || r.Method != http.MethodPatch || body.Msg != "Blob" {
+			http.Error(w, "Wrong request", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.Patch(url).AddXMLBody(Body{Msg: "Blob"}).Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestHeadRestClient_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			http.Error(w, "No head method", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var res struct{}
+	responseItem := restclient.Head(url).SendAndGetResponseItem()
+	responseItem.Json(&res)
+	rctest.CheckResult(t, responseItem.Result, rctest.Status200())
+
+	etag, ok := responseItem.Header("Etag")
+	should.BeTrue(t, ok)
+	should.BeEqual(t, etag, []string{`"v1"`})
+}
+
+func TestOptionsAndMethodRestClient_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	responseItem := restclient.Options(url).SendAndGetResponseItem()
+	rctest.CheckResult(t, responseItem.Result, rctest.Status204())
+	method, _ := responseItem.Header("X-Method")
+	should.BeEqual(t, method, []string{http.MethodOptions})
+
+	responseItem = restclient.Method("PURGE", url).SendAndGetResponseItem()
+	rctest.CheckResult(t, responseItem.Result, rctest.Status204())
+	method, _ = responseItem.Header("X-Method")
+	should.BeEqual(t, method, []string{"PURGE"})
+}
+
+func Test201PostRestClient_ok(t *testing.T) {
+	type Body struct {
+		ID  int
+		Msg string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(Body{ID: 12, Msg: "Blob"})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(js)
+	})
+
+	var res Body
+	result := restclient.Post(url).AddJsonBody(Body{Msg: "Blob"}).SendAndGetJsonResponse(&res)
+	rctest.CheckResult(t, result, rctest.Status(http.StatusCreated))
+	should.BeEqual(t, res, Body{ID: 12, Msg: "Blob"})
+}
+
+func Test204WithJsonResponse_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	var res struct{ Msg string }
+	result := restclient.Delete(url).SendAndGetJsonResponse(&res)
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestErrorJsonResponse_ok(t *testing.T) {
+	type APIError struct {
+		Code    string
+		Message string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(APIError{Code: "invalid", Message: "Blob is broken"})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write(js)
+	})
+
+	var res struct{ Msg string }
+	var notDecoded APIError
+	var apiErr APIError
+	responseItem := restclient.Get(url).SendAndGetResponseItem()
+	responseItem.Json(&res)
+	responseItem.ErrorJson(&notDecoded, http.StatusBadRequest)
+	responseItem.ErrorJson(&apiErr, http.StatusBadRequest, http.StatusUnprocessableEntity)
+	rctest.CheckResult(t, responseItem.Result, rctest.Status(http.StatusUnprocessableEntity))
+	should.BeEqual(t, res.Msg, "")
+	should.BeEqual(t, notDecoded, APIError{})
+	should.BeEqual(t, apiErr, APIError{Code: "invalid", Message: "Blob is broken"})
+}
+
+func TestErrorJsonNotDecodable_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("moved") == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusMultipleChoices)
+			w.Write([]byte(`{"Code": "choose"}`))
+			return
+		}
+		http.Error(w, "Blob is broken", http.StatusBadRequest)
+	})
+
+	var apiErr struct{ Code string }
+	responseItem := restclient.Get(url).SendAndGetResponseItem()
+	responseItem.ErrorJson(&apiErr)
+	rctest.CheckResult(t, responseItem.Result, rctest.Status(http.StatusMultipleChoices))
+	should.BeEqual(t, apiErr.Code, "")
+
+	responseItem = restclient.Get(url).AddQueryParam("moved", 1).SendAndGetResponseItem()
+	responseItem.ErrorJson(&apiErr)
+	rctest.CheckResult(t, responseItem.Result, rctest.FailedResponse(400, "Blob is broken\n"))
+	should.BeNil(t, responseItem.Result.Err)
+	should.BeEqual(t, apiErr.Code, "")
+}
+
+func TestOnErrorJson_ok(t *testing.T) {
+	type APIError struct {
+		Code    string
+		Message string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(APIError{Code: "invalid", Message: "Blob is broken"})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(js)
+	})
+
+	var apiErr APIError
+	result := restclient.Get(url).OnErrorJson(&apiErr).Send()
+	rctest.CheckResult(t, result, rctest.Status400())
+	should.BeEqual(t, apiErr, APIError{Code: "invalid", Message: "Blob is broken"})
+	should.BeEqual(t, result.ErrorBody, &apiErr)
+	should.BeEqual(t, result.Error().Error(), "[400]{Code:invalid Message:Blob is broken}")
+}
+
+func TestOnErrorXML_ok(t *testing.T) {
+	type APIError struct {
+		Code string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		x, _ := xml.Marshal(APIError{Code: "invalid"})
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusConflict)
+		w.Write(x)
+	})
+
+	var apiErr APIError
+	result := restclient.Get(url).OnErrorXML(&apiErr).Send()
+	rctest.CheckResult(t, result, rctest.Status409())
+	should.BeEqual(t, apiErr.Code, "invalid")
+	should.NotBeNil(t, result.ErrorBody)
+}
+
+func TestOnErrorJsonNotDecodable_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Blob is broken", http.StatusBadRequest)
+	})
+
+	var apiErr struct{ Code string }
+	result := restclient.Get(url).OnErrorJson(&apiErr).Send()
+	rctest.CheckResult(t, result, rctest.FailedResponse(400, "Blob is broken\n"))
+	should.BeNil(t, result.ErrorBody)
+	should.BeEqual(t, result.Error().Error(), "[400]Blob is broken\n")
+}
+
+func TestProblemResponse_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{
+			"type": "https://example.com/probs/out-of-credit",
+			"Title": "You do not have enough credit.",
+			"detail": "Your current balance is 30, but that costs 50.",
+			"instance": "/account/12345/msgs/abc",
+			"balance": 30
+		}`))
+	})
+
+	result := restclient.Get(url).Send()
+	rctest.CheckResult(t, result, rctest.Status403())
+	should.BeEqual(t, result.Problem, &restclient.Problem{
+		Type:       "https://example.com/probs/out-of-credit",
+		Title:      "You do not have enough credit.",
+		Status:     http.StatusForbidden,
+		Detail:     "Your current balance is 30, but that costs 50.",
+		Instance:   "/account/12345/msgs/abc",
+		Extensions: map[string]interface{}{"balance": float64(30)},
+	})
+
+	var problem *restclient.Problem
+	err := result.Error()
+	should.BeTrue(t, errors.As(err, &problem))
+	should.BeEqual(t, problem.Type, "https://example.com/probs/out-of-credit")
+	should.BeEqual(t, err.Error(), "[403]You do not have enough credit.: Your current balance is 30, but that costs 50.")
+}
+
+func TestHTTPError_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "12")
+		http.Error(w, "Blob not found", http.StatusNotFound)
+	})
+
+	err := restclient.Delete(url).Send().Error()
+	should.BeTrue(t, errors.Is(err, restclient.ErrNotFound))
+	should.BeFalse(t, errors.Is(err, restclient.ErrServerError))
+	should.BeEqual(t, err.Error(), "[404]Blob not found\n")
+
+	var httpErr *restclient.HTTPError
+	should.BeTrue(t, errors.As(err, &httpErr))
+	should.BeEqual(t, httpErr.StatusCode, http.StatusNotFound)
+	should.BeEqual(t, httpErr.Method, http.MethodDelete)
+	should.BeEqual(t, httpErr.URL, url)
+	should.BeEqual(t, httpErr.Header.Get("X-Request-Id"), "12")
+	should.BeEqual(t, httpErr.Body, "Blob not found\n")
+}
+
+func TestHTTPErrorCategories_ok(t *testing.T) {
+	for status, category := range map[int]error{
+		http.StatusUnauthorized:        restclient.ErrUnauthorized,
+		http.StatusInternalServerError: restclient.ErrServerError,
+		http.StatusBadGateway:          restclient.ErrServerError,
+		http.StatusRequestTimeout:      restclient.ErrTimeout,
+		http.StatusGatewayTimeout:      restclient.ErrTimeout,
+	} {
+		err := rctest.Status(status).Error()
+		should.BeTrue(t, errors.Is(err, category), status)
+		should.BeFalse(t, errors.Is(err, restclient.ErrNotFound), status)
+	}
+
+	should.BeNil(t, rctest.Status200().Error())
+}
+
+func TestTimeoutError_fail(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.Get(url).AddHttpClient(&http.Client{Timeout: 10 * time.Millisecond}).Send()
+	should.BeTrue(t, errors.Is(result.Error(), restclient.ErrTimeout))
+}
+
+func TestSendAndStream_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		for i := 0; i < 1000; i++ {
+			w.Write([]byte("blob,crop\n"))
+		}
+	})
+
+	body, result := restclient.Get(url).SendAndStream()
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, result.Header.Get("Content-Type"), "text/csv")
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	should.BeNil(t, err)
+	should.BeEqual(t, len(data), 10000)
+}
+
+func TestSendAndStreamFailed_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Blob is broken", http.StatusBadRequest)
+	})
+
+	body, result := restclient.Get(url).SendAndStream()
+	rctest.CheckResult(t, result, rctest.FailedResponse(400, "Blob is broken\n"))
+	should.BeNil(t, body)
+}
+
+func TestSendAndWriteTo_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Blob"))
+	})
+
+	var buf bytes.Buffer
+	written, result := restclient.Get(url).SendAndWriteTo(&buf)
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, written, int64(4))
+	should.BeEqual(t, buf.String(), "Blob")
+}
+
+func TestSendAndIterateJsonArray_ok(t *testing.T) {
+	type User struct {
+		Name string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			http.Error(w, "Wrong accept header", http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"Name": "Blob"}, {"Name": "Crop"}, {"Name": "Kilo"}]`))
+	})
+
+	var users []User
+	result := restclient.Get(url).SendAndIterateJsonArray(func(decode func(v interface{}) error) error {
+		var user User
+		err := decode(&user)
+		users = append(users, user)
+		return err
+	})
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, users, []User{{Name: "Blob"}, {Name: "Crop"}, {Name: "Kilo"}})
+}
+
+func TestSendAndIterateNDJson_ok(t *testing.T) {
+	type User struct {
+		Name string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/x-ndjson" {
+			http.Error(w, "Wrong accept header", http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"Name\": \"Blob\"}\n{\"Name\": \"Crop\"}\n{\"Name\": \"Kilo\"}\n"))
+	})
+
+	var users []User
+	result := restclient.Get(url).SendAndIterateNDJson(func(decode func(v interface{}) error) error {
+		if len(users) == 2 {
+			return restclient.ErrStopIteration
+		}
+
+		var user User
+		err := decode(&user)
+		users = append(users, user)
+		return err
+	})
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, users, []User{{Name: "Blob"}, {Name: "Crop"}})
+}
+
+func TestSendAndIterateJsonArrayBroken_fail(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Name": "Blob"}`))
+	})
+
+	result := restclient.Get(url).SendAndIterateJsonArray(func(decode func(v interface{}) error) error {
+		return nil
+	})
+	should.NotBeNil(t, result.Err)
+}
+
+func TestQueryParams_ok(t *testing.T) {
+	type Filter struct {
+		Limit int      `query:"limit"`
+		Name  string   `query:"name,omitempty"`
+		IDs   []string `query:"id"`
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("limit") != "14" || query.Get("offset") != "2" || len(query["id"]) != 2 || query.Has("name") {
+			http.Error(w, "Wrong query", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.New(url).
+		AddQueryParam("limit", 1).
+		AddQueryParam("offset", 2).
+		Get("").
+		AddQueryParams(Filter{Limit: 14, IDs: []string{"a", "b"}}).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestQueryKeyStyle_ok(t *testing.T) {
+	type Filter struct {
+		Page struct {
+			Limit int `query:"limit"`
+		} `query:"page"`
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "page[limit]=14" {
+			http.Error(w, "Wrong query", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	filter := Filter{}
+	filter.Page.Limit = 14
+
+	result := restclient.Get(url).SetQueryKeyStyle(rcquery.BracketKeys).AddQueryParams(filter).Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+
+	result = restclient.New(url).SetQueryKeyStyle(rcquery.BracketKeys).Get("").AddQueryParams(filter).Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestMapQueryParams_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "email=blob%40crop.de&limit=14" {
+			http.Error(w, "Wrong query", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.Get(url).AddQueryParams(map[string]interface{}{"limit": 14, "email": "blob@crop.de"}).Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestUnsupportedQueryParam_fail(t *testing.T) {
+	result := restclient.Get("http://localhost").AddQueryParam("ch", make(chan int)).Send()
+	should.NotBeNil(t, result.Err)
+}
+
+func TestUnsupportedQueryParams_fail(t *testing.T) {
+	result := restclient.Get("http://localhost").AddQueryParams("a=b").Send()
+	should.NotBeNil(t, result.Err)
+}
+
+func TestQueryArrayParam_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "ids=1,2,3" {
+			http.Error(w, "Wrong query", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.Get(url).AddQueryArrayParam("ids", []int{1, 2, 3}, rcquery.CommaArray).Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestQueryArrayFormat_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "ids=1,2&tags=a,b" && r.URL.RawQuery != "ids=1|2" {
+			http.Error(w, "Wrong query", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	client := restclient.New(url).SetQueryArrayFormat(rcquery.CommaArray)
+	result := client.Get("").
+		AddQueryParam("ids", []int{1, 2}).
+		AddQueryParam("tags", []string{"a", "b"}).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+
+	result = client.Get("").
+		SetQueryArrayFormat(rcquery.PipeArray).
+		AddQueryParam("ids", []int{1, 2}).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestQueryEncoder_ok(t *testing.T) {
+	type cents int64
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "price=12.50&from=2021-03-04" {
+			http.Error(w, "Wrong query", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.New(url).
+		RegisterQueryEncoder(cents(0), func(value interface{}) (string, error) {
+			c := value.(cents)
+			return fmt.Sprintf("%d.%02d", c/100, c%100), nil
+		}).
+		Get("").
+		SetQueryTimeLayout("2006-01-02").
+		AddQueryParam("price", cents(1250)).
+		AddQueryParam("from", time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestQueryParamWithQueryInPath_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "x=1&limit=14" {
+			http.Error(w, "Wrong query", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.Get(url+"?x=1").AddQueryParam("limit", 14).Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestPathParams_ok(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/users/a%2Fb%20c/orders/12" {
+			http.Error(w, "Wrong path "+r.URL.EscapedPath(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	result := restclient.New(testServer.URL).
+		Get("/users/{id}/orders/{orderId}").
+		PathParam("id", "a/b c").
+		PathParam("orderId", 12).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+	should.BeEqual(t, result.PathTemplate, "/users/{id}/orders/{orderId}")
+}
+
+func TestPathParams_fail(t *testing.T) {
+	result := restclient.Get("http://localhost/users/{id}/orders/{orderId}").PathParam("id", 1).Send()
+	should.NotBeNil(t, result.Err)
+
+	result = restclient.Get("http://localhost/users/{id}").PathParam("id", 1).PathParam("orderID", 2).Send()
+	should.NotBeNil(t, result.Err)
+
+	result = restclient.Get("http://localhost/users/{id}/orders").PathParam("id", "").Send()
+	should.NotBeNil(t, result.Err)
+}
+
+func TestMultipartBody_ok(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blob.json")
+	should.BeNil(t, ioutil.WriteFile(file, []byte(`{"Msg": "Blob"}`), 0600))
+
+	calls := 0
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "Try again", http.StatusServiceUnavailable)
+			return
+		}
+
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			http.Error(w, "No multipart: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("name") != "Blob" || r.FormValue("tag") != "a" {
+			http.Error(w, "Wrong fields", http.StatusBadRequest)
+			return
+		}
+
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "No file", http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		content, _ := ioutil.ReadAll(f)
+		if header.Filename != "blob.json" || header.Header.Get("Content-Type") != "application/json" || string(content) != `{"Msg": "Blob"}` {
+			http.Error(w, "Wrong file", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	policy := restclient.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+
+	result := restclient.Post(url).
+		AddMultipartBody(map[string][]string{"tag": {"a"}}).
+		AddFormField("name", "Blob").
+		AddFormFilePath("file", file).
+		AddRetryPolicy(policy).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+	should.BeEqual(t, result.Attempts, 2)
+}
+
+func TestMultipartRedirect_ok(t *testing.T) {
+	for _, compression := range []string{"", "gzip"} {
+		url := runServer(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("moved") == "" {
+				http.Redirect(w, r, r.URL.Path+"?moved=1", http.StatusTemporaryRedirect)
+				return
+			}
+
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				reader, err := gzip.NewReader(r.Body)
+				if err != nil {
+					http.Error(w, "No gzip", http.StatusBadRequest)
+					return
+				}
+				r.Body = reader
+			}
+			err := r.ParseMultipartForm(1 << 20)
+			if err != nil {
+				http.Error(w, "No multipart: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if r.FormValue("name") != "Blob" {
+				http.Error(w, "Wrong fields", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		rc := restclient.Post(url).AddFormField("name", "Blob")
+		if compression != "" {
+			rc.CompressBody(compression)
+		}
+		rctest.CheckResult(t, rc.Send(), rctest.Status204())
+	}
+}
+
+func TestMultipartFileFromReader_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		f, header, err := r.FormFile("upload")
+		if err != nil {
+			http.Error(w, "No file", http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		content, _ := ioutil.ReadAll(f)
+		if header.Filename != `cr"op.bin` || header.Header.Get("Content-Type") != "application/octet-stream" || len(content) != 1<<16 {
+			http.Error(w, "Wrong file", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	result := restclient.Put(url).
+		AddFormFile("upload", `cr"op.bin`, bytes.NewReader(make([]byte, 1<<16)), "").
+		AddRetryPolicy(restclient.DefaultRetryPolicy()).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status503())
+	should.BeEqual(t, result.Attempts, 1)
+}
+
+func TestMultipartFileNotExists_fail(t *testing.T) {
+	result := restclient.Post("http://localhost").AddFormFilePath("file", "/not/existing").Send()
+	should.NotBeNil(t, result.Err)
+}
+
+type csvCodec struct{}
+
+func (csvCodec) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (csvCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.Join(v.([]string), ",")), nil
+}
+
+func (csvCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]string)) = strings.Split(string(data), ",")
+	return nil
+}
+
+func TestCodecBody_ok(t *testing.T) {
+	restclient.RegisterCodec("text/csv", csvCodec{})
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "text/csv; charset=utf-8" || string(body) != "a,b" {
+			http.Error(w, "Wrong body", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("c,d"))
+	})
+
+	var res []string
+	responseItem := restclient.Post(url).AddEncodedBody([]string{"a", "b"}, "text/csv").SendAndGetResponseItem()
+	responseItem.Decode(&res)
+	rctest.CheckResult(t, responseItem.Result, rctest.Status200())
+	should.BeEqual(t, res, []string{"c", "d"})
+}
+
+func TestDecodeBySuffix_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.blob+json; charset=utf-8")
+		w.Write([]byte(`{"Msg": "Blob"}`))
+	})
+
+	var res struct{ Msg string }
+	responseItem := restclient.Get(url).SendAndGetResponseItem()
+	responseItem.Decode(&res)
+	rctest.CheckResult(t, responseItem.Result, rctest.Status200())
+	should.BeEqual(t, res.Msg, "Blob")
+}
+
+func TestCodecUnknown_fail(t *testing.T) {
+	result := restclient.Post("http://localhost").AddEncodedBody("Blob", "application/unknown").Send()
+	var mediaTypeErr *restclient.MediaTypeError
+	should.BeTrue(t, errors.As(result.Err, &mediaTypeErr))
+	should.BeEqual(t, mediaTypeErr.MediaType, "application/unknown")
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/unknown")
+		w.Write([]byte("Blob"))
+	})
+
+	var res string
+	responseItem := restclient.Get(url).SendAndGetResponseItem()
+	responseItem.Decode(&res)
+	should.BeTrue(t, errors.As(responseItem.Result.Err, &mediaTypeErr))
+}
+
+func TestAcceptHeader_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"` + r.Header.Get("Accept") + `"`))
+	})
+
+	var accept string
+	result := restclient.Get(url).SendAndGetJsonResponse(&accept)
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, accept, "application/json")
+
+	result = restclient.Get(url).AddHeader("Accept", "application/vnd.blob+json").SendAndGetJsonResponse(&accept)
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, accept, "application/vnd.blob+json")
+
+	result = restclient.Get(url).SendAndDecode(&accept)
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeTrue(t, strings.HasPrefix(accept, "application/json, application/xml"))
+}
+
+func TestSendAndDecode_ok(t *testing.T) {
+	type Body struct {
+		Msg string
+	}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "xml" {
+			x, _ := xml.Marshal(Body{Msg: "Blob"})
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			w.Write(x)
+			return
+		}
+		js, _ := json.Marshal(Body{Msg: "Crop"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	})
+
+	var res Body
+	result := restclient.Get(url).AddQueryParam("format", "xml").SendAndDecode(&res)
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, res.Msg, "Blob")
+
+	result = restclient.Get(url).SendAndDecode(&res)
+	rctest.CheckResult(t, result, rctest.Status200())
+	should.BeEqual(t, res.Msg, "Crop")
+}
+
+func TestSendAndDecodeUnexpectedMediaType_fail(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+
+	var res struct{}
+	result := restclient.Get(url).SendAndDecode(&res)
+
+	var mediaTypeErr *restclient.MediaTypeError
+	should.BeTrue(t, errors.As(result.Err, &mediaTypeErr))
+	should.BeEqual(t, mediaTypeErr.MediaType, "text/html")
+}
+
+func TestCompressBody_ok(t *testing.T) {
+	type Body struct {
+		Msg string
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		url := runServer(func(w http.ResponseWriter, r *http.Request) {
+			defer r.Body.Close()
+
+			var reader io.Reader
+			switch r.Header.Get("Content-Encoding") {
+			case "gzip":
+				reader, _ = gzip.NewReader(r.Body)
+			case "deflate":
+				reader, _ = zlib.NewReader(r.Body)
+			default:
+				http.Error(w, "Not compressed", http.StatusBadRequest)
+				return
+			}
+
+			var body Body
+			err := json.NewDecoder(reader).Decode(&body)
+			if err != nil || body.Msg != "Blob" {
+				http.Error(w, "Body not readable", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		result := restclient.Post(url).CompressBody(encoding).AddJsonBody(Body{Msg: "Blob"}).Send()
+		rctest.CheckResult(t, result, rctest.Status204())
+	}
+}
+
+func TestCompressMultipartBody_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "Not compressed", http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(reader)
+		if r.FormValue("name") != "Blob" {
+			http.Error(w, "Wrong field", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.Post(url).CompressBody("gzip").AddFormField("name", "Blob").Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestCompressBodyUnsupported_fail(t *testing.T) {
+	result := restclient.Post("http://localhost").CompressBody("br").Send()
+	should.NotBeNil(t, result.Err)
+}
+
+func TestDecompressResponse_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "deflate, gzip" {
+			http.Error(w, "Wrong Accept-Encoding: "+r.Header.Get("Accept-Encoding"), http.StatusBadRequest)
+			return
+		}
+
+		var buf bytes.Buffer
+		var compressor io.WriteCloser
+		switch r.URL.Query().Get("encoding") {
+		case "gzip":
+			compressor = gzip.NewWriter(&buf)
+		case "zlib":
+			compressor = zlib.NewWriter(&buf)
+		default:
+			compressor, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		}
+		compressor.Write([]byte(`{"Msg": "Blob"}`))
+		compressor.Close()
+
+		encoding := r.URL.Query().Get("encoding")
+		if encoding != "gzip" {
+			encoding = "deflate"
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf.Bytes())
+	})
+
+	for _, encoding := range []string{"gzip", "zlib", "flate"} {
+		var res struct{ Msg string }
+		result := restclient.Get(url).AcceptCompression().AddQueryParam("encoding", encoding).SendAndGetJsonResponse(&res)
+		rctest.CheckResult(t, result, rctest.Status200())
+		should.BeEqual(t, res.Msg, "Blob", encoding)
+	}
+}
+
+func TestDecompressHeadResponse_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	result := restclient.Head(url).AcceptCompression().Send()
+	rctest.CheckResult(t, result, rctest.Status200())
+}
+
+func TestMiddleware_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Trace", r.Header.Get("X-Trace"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	var calls []string
+	trace := func(name string) restclient.Middleware {
+		return func(next restclient.RoundTripFunc) restclient.RoundTripFunc {
+			return func(request *http.Request) (*http.Response, error) {
+				calls = append(calls, "before "+name)
+				request.Header.Add("X-Trace", name)
+				response, err := next(request)
+				calls = append(calls, "after "+name)
+				return response, err
+			}
+		}
+	}
+
+	client := restclient.New(url).AddMiddleware(trace("client"))
+	responseItem := client.Get("").
+		AddMiddleware(trace("request")).
+		AddMiddleware(restclient.AfterResponse(func(response *http.Response) error {
+			calls = append(calls, "status "+strconv.Itoa(response.StatusCode))
+			return nil
+		})).
+		SendAndGetResponseItem()
+	rctest.CheckResult(t, responseItem.Result, rctest.Status204())
+
+	traceHeader, _ := responseItem.Header("X-Trace")
+	should.BeEqual(t, traceHeader, []string{"client"})
+	should.BeEqual(t, calls, []string{"before client", "before request", "status 204", "after request", "after client"})
+}
+
+func TestMiddlewareAbort_fail(t *testing.T) {
+	calls := 0
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	abort := errors.New("abort")
+	result := restclient.Get(url).
+		AddMiddleware(restclient.BeforeRequest(func(request *http.Request) error {
+			return abort
+		})).
+		Send()
+	should.BeTrue(t, errors.Is(result.Err, abort))
+	should.BeEqual(t, calls, 0)
+}
+
+func TestMiddlewareAbortNoRetry_fail(t *testing.T) {
+	calls := 0
+	abort := errors.New("abort")
+	result := restclient.Get("http://localhost").
+		AddRetryPolicy(restclient.DefaultRetryPolicy()).
+		AddMiddleware(restclient.BeforeRequest(func(request *http.Request) error {
+			calls++
+			return abort
+		})).
+		Send()
+	should.BeTrue(t, errors.Is(result.Err, abort))
+	should.BeEqual(t, calls, 1)
+	should.BeEqual(t, result.Attempts, 1)
+}
+
+func TestMiddlewareNoResponse_fail(t *testing.T) {
+	result := restclient.Get("http://localhost").
+		AddRetryPolicy(restclient.DefaultRetryPolicy()).
+		AddMiddleware(func(next restclient.RoundTripFunc) restclient.RoundTripFunc {
+			return func(request *http.Request) (*http.Response, error) {
+				return nil, nil
+			}
+		}).
+		Send()
+	should.NotBeNil(t, result.Err)
+	should.BeEqual(t, result.Attempts, 1)
+}
+
+func TestMiddlewareAbortClosesBody_fail(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blob.json")
+	should.BeNil(t, ioutil.WriteFile(file, []byte(`{"Msg": "Blob"}`), 0600))
+
+	abort := errors.New("abort")
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		result := restclient.Post("http://localhost").
+			AddFormFilePath("file", file).
+			AddMiddleware(restclient.BeforeRequest(func(request *http.Request) error {
+				return abort
+			})).
+			Send()
+		should.BeTrue(t, errors.Is(result.Err, abort))
+	}
+
+	// the writers of the multipart bodies stop after the body is closed
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines+5; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	should.BeTrue(t, runtime.NumGoroutine() <= goroutines+5, runtime.NumGoroutine(), goroutines)
+}
+
+func TestBearerToken_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer blob" {
+			http.Error(w, "Wrong token", http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.Get(url).AddBearerToken("blob").Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+
+	result = restclient.New(url).AddBearerToken("crop").Get("").Send()
+	rctest.CheckResult(t, result, rctest.Status401())
+}
+
+func TestClientCredentials_ok(t *testing.T) {
+	tokens := 0
+	validToken := ""
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pw, _ := r.BasicAuth()
+		if user != "id" || pw != "secret" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read write" {
+			http.Error(w, "Wrong credentials", http.StatusUnauthorized)
+			return
+		}
+
+		tokens++
+		validToken = "token" + strconv.Itoa(tokens)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "` + validToken + `", "token_type": "bearer", "expires_in": 3600}`))
+	})
+	mux.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "Blob" {
+			http.Error(w, "Body not replayed", http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+validToken {
+			http.Error(w, "Wrong token", http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	source := restclient.NewClientCredentials(testServer.URL+"/token", "id", "secret", "read", "write")
+	client := restclient.New(testServer.URL).AddTokenSource(source)
+
+	for i := 0; i < 3; i++ {
+		result := client.Post("/test").AddBody([]byte("Blob"), "text/plain").Send()
+		rctest.CheckResult(t, result, rctest.Status204())
+	}
+	should.BeEqual(t, tokens, 1)
+
+	// token is revoked by the server
+	validToken = "revoked"
+	result := client.Post("/test").AddBody([]byte("Blob"), "text/plain").Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+	should.BeEqual(t, tokens, 2)
+}
+
+func TestClientCredentials_fail(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Wrong credentials", http.StatusUnauthorized)
+	})
+
+	result := restclient.Get("http://localhost").
+		AddTokenSource(restclient.NewClientCredentials(url, "id", "secret")).
+		Send()
+	should.BeTrue(t, errors.Is(result.Err, restclient.ErrUnauthorized))
+}
+
+type bufferLogger struct {
+	lines []string
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *bufferLogger) String() string {
+	return strings.Join(l.lines, "\n")
+}
+
+func TestAPIKey_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "s3cr3t/key" || r.URL.Query().Get("api_key") != "qu3ry key" {
+			http.Error(w, "Wrong api key", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Echo", r.Header.Get("X-API-Key"))
+		w.Write([]byte("your key: " + r.URL.Query().Get("api_key")))
+	})
+
+	logger := &bufferLogger{}
+	result := restclient.New(url).
+		AddLogger(logger).
+		AddAPIKey(restclient.APIKeyInHeader, "X-API-Key", "s3cr3t/key").
+		Get("").
+		AddAPIKey(restclient.APIKeyInQuery, "api_key", "qu3ry key").
+		Send()
+	rctest.CheckResult(t, result, rctest.Status200())
+
+	logs := logger.String()
+	should.BeTrue(t, strings.Contains(logs, "api_key=***"), logs)
+	should.BeTrue(t, strings.Contains(logs, "your key: ***"), logs)
+	should.BeFalse(t, strings.Contains(logs, "s3cr3t"), logs)
+	should.BeFalse(t, strings.Contains(logs, "qu3ry"), logs)
+}
+
+func TestSigner_ok(t *testing.T) {
+	signer := &rcsign.HMACSigner{KeyID: "key", Secret: []byte("secret")}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		signature := r.Header.Get("Authorization")
+		r.Header.Del("Authorization")
+		r.URL.Host = r.Host
+		body, _ := ioutil.ReadAll(r.Body)
+		r.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+
+		// sign again on server side
+		expected := &rcsign.HMACSigner{
+			KeyID:  "key",
+			Secret: []byte("secret"),
+			Now: func() time.Time {
+				date, _ := time.Parse(time.RFC3339, r.Header.Get("X-Date"))
+				return date
+			},
+		}
+		expected.Sign(r)
+		if signature == "" || signature != r.Header.Get("Authorization") {
+			http.Error(w, "Wrong signature", http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.New(url).
+		AddSigner(signer).
+		Post("").
+		AddQueryParam("limit", 2).
+		AddJsonBody(map[string]string{"Msg": "Blob"}).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestSignerMultipart_ok(t *testing.T) {
+	signer := &rcsign.AWSV4Signer{AccessKeyID: "key", SecretAccessKey: "secret", Region: "eu-central-1", Service: "s3"}
+
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		hash := sha256.Sum256(body)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(hash[:]) {
+			http.Error(w, "Wrong body hash", http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	result := restclient.New(url).
+		AddSigner(signer).
+		Post("").
+		AddFormField("name", "Blob").
+		AddFormField("tag", "a").
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+}
+
+func TestLogConfigRedaction_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=cookie-value")
+		w.Write([]byte(`{"name":"Hans","password":"pw-value","items":[{"token":"token-value"}]}`))
+	})
+
+	logger := &bufferLogger{}
+	result := restclient.Post(url).
+		AddLogger(logger).
+		SetLogConfig(restclient.LogConfig{
+			Level:             restclient.LogFull,
+			RedactHeaders:     []string{"x-custom"},
+			RedactQueryParams: []string{"sig"},
+			RedactJsonFields:  []string{"Password", "token"},
+			LogRequestBody:    true,
+		}).
+		AddHeader("Authorization", "Bearer header-value").
+		AddHeader("X-Custom", "custom-value").
+		AddQueryParam("sig", "query-value").
+		AddQueryParam("page", "1").
+		AddJsonBody(map[string]string{"password": "request-value"}).
+		Send()
+	rctest.CheckResult(t, result, rctest.Status200())
+
+	logs := logger.String()
+	should.BeTrue(t, strings.Contains(logs, "sig=***&page=1"), logs)
+	should.BeTrue(t, strings.Contains(logs, `"name":"Hans"`), logs)
+	should.BeTrue(t, strings.Contains(logs, "request Body"), logs)
+	for _, secret := range []string{"header-value", "custom-value", "query-value", "cookie-value", "pw-value", "token-value", "request-value"} {
+		should.BeFalse(t, strings.Contains(logs, secret), logs)
+	}
+}
+
+func TestLogConfigLevel_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	})
+
+	logger := &bufferLogger{}
+	restclient.Get(url).
+		AddLogger(logger).
+		SetLogConfig(restclient.LogConfig{Level: restclient.LogSummary}).
+		Send()
+	logs := logger.String()
+	should.BeTrue(t, strings.Contains(logs, "response Status"), logs)
+	should.BeFalse(t, strings.Contains(logs, "Headers"), logs)
+	should.BeFalse(t, strings.Contains(logs, "response Body"), logs)
+
+	logger = &bufferLogger{}
+	restclient.New(url).
+		AddLogger(logger).
+		SetLogConfig(restclient.LogConfig{Level: restclient.LogFull, MaxBodyLength: 4}).
+		Get("").
+		Send()
+	logs = logger.String()
+	should.BeTrue(t, strings.Contains(logs, "response Body: 0123... (truncated, 10 bytes)"), logs)
+
+	logger = &bufferLogger{}
+	restclient.Get(url).
+		AddLogger(logger).
+		SetLogConfig(restclient.LogConfig{Level: restclient.LogOff}).
+		Send()
+	should.BeEqual(t, len(logger.lines), 0)
+}
+
+func TestLogConfigSensitiveHeaders_ok(t *testing.T) {
+	url := runServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	logger := &bufferLogger{}
+	result := restclient.Get(url).
+		AddLogger(logger).
+		SetLogConfig(restclient.LogConfig{Level: restclient.LogHeaders}).
+		AddBasicAuth("user", "pw").
+		AddHeader("X-Amz-Security-Token", "session-token").
+		Send()
+	rctest.CheckResult(t, result, rctest.Status204())
+
+	logs := logger.String()
+	should.BeTrue(t, strings.Contains(logs, "Authorization:[***]"), logs)
+	should.BeFalse(t, strings.Contains(logs, "Basic"), logs)
+	should.BeFalse(t, strings.Contains(logs, "session-token"), logs)
+}
@@ -1,23 +1,53 @@
 package restclient
 
 import (
-	"errors"
-	"strconv"
+	"fmt"
+	"net/http"
+	"reflect"
 )
 
 type Result struct {
-	Link          string
-	StatusCode    int
+	Link       string
+	StatusCode int
+	Method     string
+	// PathTemplate is the path of the request without filled path params.
+	PathTemplate  string
+	Header        http.Header
 	ResponseError string
-	Err           error
+	// ErrorBody is the decoded body of a failed response, see OnErrorJson/OnErrorXML.
+	ErrorBody interface{}
+	// Problem is the problem detail of a failed application/problem+json response.
+	Problem  *Problem
+	Err      error
+	Attempts int
 }
 
+// Error returns the internal error of the rest client or
+// a *HTTPError if the response failed (status >= 400).
 func (r Result) Error() error {
 	if r.Err != nil {
 		return r.Err
 	}
 	if r.StatusCode >= 400 {
-		return errors.New("[" + strconv.Itoa(r.StatusCode) + "]" + r.ResponseError)
+		return &HTTPError{
+			StatusCode: r.StatusCode,
+			Method:     r.Method,
+			URL:        r.Link,
+			Header:     r.Header,
+			Body:       r.ResponseError,
+			ErrorBody:  r.ErrorBody,
+			Problem:    r.Problem,
+		}
 	}
 	return nil
 }
+
+func renderErrorBody(body interface{}) string {
+	switch b := body.(type) {
+	case error:
+		return b.Error()
+	case fmt.Stringer:
+		return b.String()
+	}
+	return fmt.Sprintf("%+v", reflect.Indirect(reflect.ValueOf(body)).Interface())
+}
@@ -0,0 +1,133 @@
+package restclient
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes if and when a failed request is sent again.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait time before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the wait time between two attempts,
+	// also if the server asks for a longer wait via Retry-After.
+	MaxBackoff time.Duration
+	// Multiplier increases the backoff after every attempt.
+	Multiplier float64
+	// Jitter is the random part of the backoff, between 0 and 1.
+	Jitter float64
+	// RetryOnStatus lists the status codes that are retried.
+	RetryOnStatus []int
+	// RetryOnNetworkError retries requests that got no response at all.
+	RetryOnNetworkError bool
+}
+
+// DefaultRetryPolicy retries up to 3 attempts on network errors
+// and on the status codes 429, 502, 503 and 504.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryOnStatus: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryOnNetworkError: true,
+	}
+}
+
+// transportError marks errors of the http client, only they are retried
+// as network errors. Errors of middlewares are never retried.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// send sends the request with the http client and marks its errors as transport errors.
+func send(httpClient *http.Client) RoundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		response, err := httpClient.Do(request)
+		if err != nil {
+			return nil, &transportError{err: err}
+		}
+		return response, nil
+	}
+}
+
+func (p *RetryPolicy) retry(response *http.Response, err error) bool {
+	if err != nil {
+		var transportErr *transportError
+		return p.RetryOnNetworkError && errors.As(err, &transportErr)
+	}
+
+	for _, status := range p.RetryOnStatus {
+		if response.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff calculates the wait time after the given attempt.
+func (p *RetryPolicy) backoff(attempt int, response *http.Response) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	wait := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (2*rand.Float64() - 1)
+	}
+	backoff := time.Duration(wait)
+
+	if response != nil {
+		if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok && retryAfter > backoff {
+			backoff = retryAfter
+		}
+	}
+
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff < 0 {
+		backoff = 0
+	}
+	return backoff
+}
+
+// parseRetryAfter supports both formats of the Retry-After header,
+// delay in seconds and http date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,35 @@
+package restclient
+
+import (
+	"net/http"
+)
+
+// Signer signs the fully assembled request right before it's sent,
+// see the package rcsign for implementations.
+type Signer interface {
+	Sign(request *http.Request) error
+}
+
+// AddSigner signs the request after all headers are set and all middlewares are called.
+func (r *RestClient) AddSigner(signer Signer) *RestClient {
+	r.signer = signer
+	return r
+}
+
+func (c *Client) AddSigner(signer Signer) *Client {
+	c.signer = signer
+	return c
+}
+
+// signerMiddleware signs every attempt of the request.
+func signerMiddleware(signer Signer) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			err := signer.Sign(request)
+			if err != nil {
+				return nil, err
+			}
+			return next(request)
+		}
+	}
+}